@@ -0,0 +1,229 @@
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AuthzMemory/core"
+)
+
+const (
+	// AuditHookStdout indicates logs are streamed to stdout
+	AuditHookStdout = ""
+	// AuditHookFile indicates logs are written to a size rotated file
+	AuditHookFile = "file"
+	// AuditHookSyslog indicates logs are sent to the local syslog daemon
+	AuditHookSyslog = "syslog"
+	// AuditHookNone disables the audit log
+	AuditHookNone = "none"
+)
+
+// defaultAuditLogPath is the file test hook log path
+const defaultAuditLogPath = "/var/log/authz-broker.log"
+
+const (
+	// BodyRedactionAll drops the request bodies from the audit records
+	BodyRedactionAll = "all"
+	// BodyRedactionSensitive masks environment values and the fields named like secrets (password, token...)
+	BodyRedactionSensitive = "sensitive"
+	// BodyRedactionNone keeps the request bodies as sent
+	BodyRedactionNone = "none"
+)
+
+// redacted replaces the sensitive values of request bodies
+const redacted = "<redacted>"
+
+// sensitiveFields are the lower case fragments of the body field names whose values are redacted
+var sensitiveFields = []string{"password", "passwd", "secret", "token", "credential", "auth"}
+
+// BasicAuditorSettings provides settings for the basic auditor
+type BasicAuditorSettings struct {
+	LogHook       string // LogHook is where the audit records are written (file, syslog, none), stdout when empty
+	LogPath       string // LogPath is the audit log file, defaults to /var/log/authz-broker.log
+	MaxSize       int64  // MaxSize rotates the audit log file once it would exceed this size, zero disables rotation
+	MaxBackups    int    // MaxBackups is the number of rotated audit log files kept
+	Compress      bool   // Compress gzips the rotated audit log files
+	BodyRedaction string // BodyRedaction is how request bodies are redacted in the records (all, sensitive, none)
+
+	KeyPath            string        // KeyPath is the ed25519 key signing the checkpoints, generated if missing
+	CheckpointInterval time.Duration // CheckpointInterval is the delay between two signed checkpoints, zero disables them and restarts of the chain cannot be verified
+}
+
+// basicAuditor writes the audit records as hash chained JSON lines
+type basicAuditor struct {
+	sync.Mutex
+	settings *BasicAuditorSettings
+	writer   io.Writer  // writer is the audit sink, nil when auditing is disabled
+	chain    *hashChain // chain seals the records
+}
+
+// NewBasicAuditor creates a new basic auditor
+func NewBasicAuditor(settings *BasicAuditorSettings) core.Auditor {
+	return &basicAuditor{settings: settings}
+}
+
+// validateBodyRedaction returns an error if the body redaction is unknown
+func validateBodyRedaction(redaction string) error {
+	switch redaction {
+	case BodyRedactionAll, BodyRedactionSensitive, BodyRedactionNone:
+		return nil
+	}
+	return fmt.Errorf("Unknown body redaction %q", redaction)
+}
+
+// Init opens the audit sink
+func (a *basicAuditor) Init() error {
+	if a.settings.BodyRedaction == "" {
+		a.settings.BodyRedaction = BodyRedactionSensitive
+	}
+	if err := validateBodyRedaction(a.settings.BodyRedaction); err != nil {
+		return err
+	}
+	a.chain = &hashChain{interval: a.settings.CheckpointInterval}
+	if a.settings.CheckpointInterval > 0 {
+		if a.settings.KeyPath == "" {
+			a.settings.KeyPath = defaultAuditKeyPath
+		}
+		key, err := loadAuditKey(a.settings.KeyPath)
+		if err != nil {
+			return err
+		}
+		a.chain.key = key
+	}
+	switch a.settings.LogHook {
+	case AuditHookStdout:
+		a.writer = os.Stdout
+	case AuditHookFile:
+		if a.settings.LogPath == "" {
+			a.settings.LogPath = defaultAuditLogPath
+		}
+		last, err := lastAuditRecord(a.settings.LogPath, a.settings.Compress)
+		if err != nil {
+			return err
+		}
+		if last != nil {
+			a.chain.resume(last)
+		}
+		file, err := openRotatingFile(a.settings.LogPath, a.settings.MaxSize, a.settings.MaxBackups, a.settings.Compress)
+		if err != nil {
+			return err
+		}
+		a.writer = file
+	case AuditHookSyslog:
+		writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, "authz-broker")
+		if err != nil {
+			return err
+		}
+		a.writer = writer
+	case AuditHookNone:
+	default:
+		return fmt.Errorf("Unknown audit hook %q", a.settings.LogHook)
+	}
+	return nil
+}
+
+// Audit seals the record into the hash chain and writes it as a JSON line, preceded by a signed checkpoint
+// when one is due or when the chain starts or resumes
+func (a *basicAuditor) Audit(record *core.AuditRecord) error {
+	if a.writer == nil {
+		return nil
+	}
+	record.Body = redactBody(record.Body, a.settings.BodyRedaction)
+	a.Lock()
+	defer a.Unlock()
+	if now := time.Now(); a.chain.checkpointDue(now) {
+		checkpoint, err := a.chain.checkpoint(now)
+		if err != nil {
+			return err
+		}
+		if _, err := a.writer.Write(checkpoint); err != nil {
+			return err
+		}
+	}
+	line, err := a.chain.seal(record)
+	if err != nil {
+		return err
+	}
+	_, err = a.writer.Write(line)
+	return err
+}
+
+// marshalLine encodes a value as a JSON line, without escaping HTML characters
+func marshalLine(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// redactBody applies the redaction to a JSON request body
+func redactBody(body json.RawMessage, redaction string) json.RawMessage {
+	switch {
+	case len(body) == 0 || redaction == BodyRedactionNone:
+		return body
+	case redaction == BodyRedactionAll:
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil
+	}
+	masked, err := marshalLine(redactValue("", value))
+	if err != nil {
+		return nil
+	}
+	return bytes.TrimSuffix(masked, []byte("\n"))
+}
+
+// redactValue masks the environment values and the values of sensitive fields found in a decoded JSON value,
+// field names are matched case insensitively as the daemon decodes them
+func redactValue(name string, value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for field, v := range value {
+			value[field] = redactValue(field, v)
+		}
+		return value
+	case []interface{}:
+		for i, v := range value {
+			if s, ok := v.(string); ok && strings.EqualFold(name, "Env") {
+				value[i] = strings.SplitN(s, "=", 2)[0] + "=" + redacted
+				continue
+			}
+			value[i] = redactValue(name, v)
+		}
+		return value
+	case nil:
+		return nil
+	}
+	lower := strings.ToLower(name)
+	for _, fragment := range sensitiveFields {
+		if strings.Contains(lower, fragment) {
+			return redacted
+		}
+	}
+	return value
+}
+
+// LedgerState returns the memory committed on the host and to the tenant
+func (f *basicAuthorizer) LedgerState(tenant string) core.LedgerState {
+	if f.ledger == nil {
+		return core.LedgerState{}
+	}
+	capacity, used := f.ledger.snapshot()
+	state := core.LedgerState{Capacity: capacity.Memory, Used: used.Memory}
+	if tenant != "" {
+		state.TenantUsed, state.TenantQuota = f.ledger.tenantUsage(tenant)
+	}
+	return state
+}
@@ -0,0 +1,348 @@
+package authz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AuthzMemory/core"
+	"github.com/Sirupsen/logrus"
+)
+
+// defaultAuditKeyPath is the key signing the audit log checkpoints
+const defaultAuditKeyPath = "/var/lib/authz-broker/audit.key"
+
+const (
+	// auditPrivateKeyType prefixes the base64 ed25519 private key of key files
+	auditPrivateKeyType = "ed25519-private"
+	// auditPublicKeyType prefixes the base64 ed25519 public key of public key files
+	auditPublicKeyType = "ed25519-public"
+)
+
+// maxAuditLine bounds the length of the audit records read back
+const maxAuditLine = 16 << 20
+
+// hashChain seals audit records into a hash chain, every record carrying the hash of the previous one,
+// and emits checkpoints signing the head of the chain
+type hashChain struct {
+	seq            uint64
+	prevHash       string
+	key            ed25519.PrivateKey
+	interval       time.Duration
+	lastCheckpoint time.Time
+}
+
+// seal numbers and chains the record and returns its JSON line ending with its hash
+func (c *hashChain) seal(record *core.AuditRecord) ([]byte, error) {
+	record.Seq = c.seq + 1
+	record.PrevHash = c.prevHash
+	record.Hash = ""
+	line, err := marshalLine(record)
+	if err != nil {
+		return nil, err
+	}
+	body := bytes.TrimSuffix(line, []byte("\n"))
+	hash := recordHash(body)
+	c.seq, c.prevHash = record.Seq, hash
+	return append(append(body[:len(body)-1], fmt.Sprintf(`,"hash":%q}`, hash)...), '\n'), nil
+}
+
+// checkpointDue returns whether a signed checkpoint should be written before the next record, a checkpoint
+// starts every new or resumed chain so that verifiers can tell a restart from a truncated log
+func (c *hashChain) checkpointDue(now time.Time) bool {
+	if c.key == nil {
+		return false
+	}
+	return c.lastCheckpoint.IsZero() || c.interval > 0 && now.Sub(c.lastCheckpoint) >= c.interval
+}
+
+// checkpoint returns a sealed checkpoint record signing the head of the chain
+func (c *hashChain) checkpoint(now time.Time) ([]byte, error) {
+	c.lastCheckpoint = now
+	record := &core.AuditRecord{
+		Timestamp: now,
+		Phase:     core.AuditPhaseCheckpoint,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(c.key, checkpointMessage(c.seq+1, c.prevHash))),
+	}
+	return c.seal(record)
+}
+
+// resume continues the chain after the last record of an existing audit log
+func (c *hashChain) resume(last *core.AuditRecord) {
+	c.seq, c.prevHash = last.Seq, last.Hash
+}
+
+// recordHash returns the hex sha256 of a record line without its hash
+func recordHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkpointMessage is what checkpoints sign, the sequence of the checkpoint and the hash of the record before it
+func checkpointMessage(seq uint64, prevHash string) []byte {
+	return []byte(fmt.Sprintf("%d:%s", seq, prevHash))
+}
+
+// unsealRecord decodes an audit line, returning the record and the line its hash was computed on
+func unsealRecord(line []byte) (*core.AuditRecord, []byte, error) {
+	var record core.AuditRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, nil, fmt.Errorf("malformed record: %v", err)
+	}
+	suffix := []byte(fmt.Sprintf(`,"hash":%q}`, record.Hash))
+	if record.Hash == "" || !bytes.HasSuffix(line, suffix) {
+		return &record, nil, fmt.Errorf("record is not sealed")
+	}
+	return &record, append(line[:len(line)-len(suffix):len(line)-len(suffix)], '}'), nil
+}
+
+// loadAuditKey reads the private key signing the checkpoints, generating it and its public key file if missing
+func loadAuditKey(path string) (ed25519.PrivateKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, encodeAuditKey(auditPrivateKeyType, private), 0600); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path+".pub", encodeAuditKey(auditPublicKeyType, public), 0644); err != nil {
+			return nil, err
+		}
+		return private, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyType, key, err := decodeAuditKey(content)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid audit key %s: %v", path, err)
+	}
+	if keyType != auditPrivateKeyType || len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("Invalid audit key %s: not an ed25519 private key", path)
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// LoadAuditPublicKey reads the key verifying the checkpoints from a public or private key file
+func LoadAuditPublicKey(path string) (ed25519.PublicKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keyType, key, err := decodeAuditKey(content)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid audit key %s: %v", path, err)
+	}
+	switch {
+	case keyType == auditPublicKeyType && len(key) == ed25519.PublicKeySize:
+		return ed25519.PublicKey(key), nil
+	case keyType == auditPrivateKeyType && len(key) == ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key).Public().(ed25519.PublicKey), nil
+	}
+	return nil, fmt.Errorf("Invalid audit key %s: not an ed25519 key", path)
+}
+
+// encodeAuditKey formats a key file, the key type followed by the base64 key
+func encodeAuditKey(keyType string, key []byte) []byte {
+	return []byte(fmt.Sprintf("%s %s\n", keyType, base64.StdEncoding.EncodeToString(key)))
+}
+
+// decodeAuditKey parses a key file
+func decodeAuditKey(content []byte) (string, []byte, error) {
+	fields := strings.Fields(string(content))
+	if len(fields) != 2 {
+		return "", nil, fmt.Errorf("expected a key type and a base64 key")
+	}
+	key, err := base64.StdEncoding.DecodeString(fields[1])
+	return fields[0], key, err
+}
+
+// openAuditFile opens an audit log file, transparently decompressing gzipped ones
+func openAuditFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, file}, nil
+}
+
+// newAuditScanner returns a line scanner accepting long audit records
+func newAuditScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxAuditLine)
+	return scanner
+}
+
+// lastAuditRecord returns the last sealed record of the audit log, looking into the most recent rotated file
+// when the log is empty, nil if there is none or if it is not sealed
+func lastAuditRecord(path string, compress bool) (*core.AuditRecord, error) {
+	backup := path + ".1"
+	if compress {
+		backup += ".gz"
+	}
+	for _, file := range []string{path, backup} {
+		reader, err := openAuditFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var last []byte
+		scanner := newAuditScanner(reader)
+		for scanner.Scan() {
+			if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+				last = append(last[:0], scanner.Bytes()...)
+			}
+		}
+		err = scanner.Err()
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		if last == nil {
+			continue
+		}
+		record, _, err := unsealRecord(last)
+		if err != nil {
+			logrus.Warnf("Cannot resume the audit log chain from %s, starting a new chain: %v", file, err)
+			return nil, nil
+		}
+		return record, nil
+	}
+	return nil, nil
+}
+
+// AuditChainError locates the first broken record of an audit log
+type AuditChainError struct {
+	File string // File is the audit log file
+	Line int    // Line is the line of the broken record in the file
+	Seq  uint64 // Seq is the sequence of the broken record, zero if unreadable
+	Msg  string // Msg describes how the chain is broken
+}
+
+// Error formats the location and cause of the broken chain
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("%s:%d: record %d: %s", e.File, e.Line, e.Seq, e.Msg)
+}
+
+// AuditVerifier walks audit log files in chronological order and checks their hash chain and checkpoints
+type AuditVerifier struct {
+	Records     int       // Records is the number of verified records, checkpoints included
+	Checkpoints int       // Checkpoints is the number of verified checkpoints
+	Restarts    int       // Restarts is the number of times the chain started over with a signed checkpoint
+	Unsigned    int       // Unsigned is the number of records after the last checkpoint
+	LastSigned  time.Time // LastSigned is the time of the last checkpoint
+
+	publicKey ed25519.PublicKey
+	seq       uint64
+	prevHash  string
+}
+
+// NewAuditVerifier creates a verifier, checkpoint signatures are only checked with a public key
+func NewAuditVerifier(publicKey ed25519.PublicKey) *AuditVerifier {
+	return &AuditVerifier{publicKey: publicKey}
+}
+
+// Verify checks the records of an audit log file continue the chain of the files verified before,
+// it returns an *AuditChainError for the first broken record. A chain starting over must begin with
+// a checkpoint whose signature is verified, otherwise a truncated log could pass for a restarted one
+func (v *AuditVerifier) Verify(path string) error {
+	reader, err := openAuditFile(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scanner := newAuditScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err := v.verifyRecord(scanner.Bytes()); err != nil {
+			err.File, err.Line = path, line
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// verifyRecord checks a single record against the chain
+func (v *AuditVerifier) verifyRecord(line []byte) *AuditChainError {
+	record, body, err := unsealRecord(line)
+	if err != nil {
+		var seq uint64
+		if record != nil {
+			seq = record.Seq
+		}
+		return &AuditChainError{Seq: seq, Msg: err.Error()}
+	}
+	if hash := recordHash(body); hash != record.Hash {
+		return &AuditChainError{Seq: record.Seq, Msg: "record was modified, its hash does not match its content"}
+	}
+	start := record.Seq == 1 && record.PrevHash == ""
+	switch {
+	case start && (v.Records > 0 || v.publicKey != nil):
+		// anyone can start a chain over, only a checkpoint signed by the audit key vouches for it
+		if record.Phase != core.AuditPhaseCheckpoint || v.publicKey == nil {
+			return &AuditChainError{Seq: record.Seq, Msg: "chain starts over without a signed checkpoint"}
+		}
+		if v.Records > 0 {
+			v.Restarts++
+		}
+	case v.Records == 0:
+		// the first record anchors the chain, the records before it may have been rotated away
+	case record.Seq <= v.seq:
+		return &AuditChainError{Seq: record.Seq, Msg: fmt.Sprintf("record is out of order, it follows record %d", v.seq)}
+	case record.Seq > v.seq+1:
+		return &AuditChainError{Seq: record.Seq, Msg: fmt.Sprintf("%d records missing after record %d", record.Seq-v.seq-1, v.seq)}
+	case record.PrevHash != v.prevHash:
+		return &AuditChainError{Seq: record.Seq, Msg: fmt.Sprintf("previous hash does not match record %d", v.seq)}
+	}
+	if record.Phase == core.AuditPhaseCheckpoint {
+		if v.publicKey != nil {
+			signature, err := base64.StdEncoding.DecodeString(record.Signature)
+			if err != nil || !ed25519.Verify(v.publicKey, checkpointMessage(record.Seq, record.PrevHash), signature) {
+				return &AuditChainError{Seq: record.Seq, Msg: "checkpoint signature is invalid"}
+			}
+		}
+		v.Checkpoints++
+		v.Unsigned = -1
+		v.LastSigned = record.Timestamp
+	}
+	v.Records++
+	v.Unsigned++
+	v.seq, v.prevHash = record.Seq, record.Hash
+	return nil
+}
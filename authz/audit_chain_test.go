@@ -0,0 +1,152 @@
+package authz
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AuthzMemory/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditChain(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "authz-broker.log")
+	keyPath := filepath.Join(dir, "keys", "audit.key")
+
+	writeRecords := func(count int) {
+		auditor := NewBasicAuditor(&BasicAuditorSettings{LogHook: AuditHookFile, LogPath: path, KeyPath: keyPath, CheckpointInterval: time.Hour})
+		assert.NoError(t, auditor.Init())
+		for i := 0; i < count; i++ {
+			assert.NoError(t, auditor.Audit(&core.AuditRecord{
+				Phase:    core.AuditPhaseRequest,
+				Tenant:   "team-a",
+				Method:   "POST",
+				URI:      "/v1.24/containers/create",
+				Action:   core.ActionContainerCreate,
+				Decision: core.DecisionAllow,
+			}))
+		}
+	}
+	// the second auditor resumes the chain of the first one and starts with a checkpoint
+	writeRecords(3)
+	writeRecords(2)
+
+	publicKey, err := LoadAuditPublicKey(keyPath + ".pub")
+	assert.NoError(t, err)
+	verifier := NewAuditVerifier(publicKey)
+	assert.NoError(t, verifier.Verify(path))
+	assert.Equal(t, 7, verifier.Records)
+	assert.Equal(t, 2, verifier.Checkpoints)
+	assert.Equal(t, 2, verifier.Unsigned)
+	assert.Equal(t, 0, verifier.Restarts)
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.SplitAfter(strings.TrimSuffix(string(content), "\n"), "\n")
+	assert.Len(t, lines, 7)
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		lines    []string
+		key      ed25519.PublicKey
+		expected string
+	}{
+		{"modified", append(append(append([]string{}, lines[:2]...), strings.Replace(lines[2], `"allow"`, `"deny"`, 1)), lines[3:]...), publicKey,
+			"record 3: record was modified, its hash does not match its content"},
+		{"removed", append(append([]string{}, lines[:2]...), lines[3:]...), publicKey,
+			"record 4: 1 records missing after record 2"},
+		{"reordered", append(append([]string{}, lines[:2]...), lines[3], lines[2], lines[4], lines[5], lines[6]), publicKey,
+			"record 4: 1 records missing after record 2"},
+		{"swapped back", append(append([]string{}, lines[:3]...), lines[1]), publicKey,
+			"record 2: record is out of order, it follows record 3"},
+		{"truncated", []string{lines[0], lines[1][:40] + "\n"}, publicKey,
+			"record 0: malformed record: unexpected end of JSON input"},
+		{"forged key", lines, otherKey.Public().(ed25519.PublicKey),
+			"record 1: checkpoint signature is invalid"},
+		{"rotated away", lines[2:], publicKey, ""},
+	}
+
+	for _, test := range tests {
+		tampered := filepath.Join(dir, test.name)
+		assert.NoError(t, ioutil.WriteFile(tampered, []byte(strings.Join(test.lines, "")), 0600))
+		err := NewAuditVerifier(test.key).Verify(tampered)
+		if test.expected == "" {
+			assert.NoError(t, err, test.name)
+			continue
+		}
+		if assert.Error(t, err, test.name) {
+			assert.Contains(t, err.Error(), test.expected, test.name)
+		}
+	}
+}
+
+func TestAuditChainRestart(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "audit.key")
+
+	// writeChain writes a new chain of records to its own log file and returns its lines
+	writeChain := func(name, keyPath string, interval time.Duration, count int) string {
+		path := filepath.Join(dir, name)
+		auditor := NewBasicAuditor(&BasicAuditorSettings{LogHook: AuditHookFile, LogPath: path, KeyPath: keyPath, CheckpointInterval: interval})
+		assert.NoError(t, auditor.Init())
+		for i := 0; i < count; i++ {
+			assert.NoError(t, auditor.Audit(&core.AuditRecord{Phase: core.AuditPhaseRequest, Method: "GET", URI: "/v1.24/info", Decision: core.DecisionAllow}))
+		}
+		content, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		return string(content)
+	}
+	first := writeChain("first", keyPath, time.Hour, 3)
+	signed := writeChain("signed", keyPath, time.Hour, 2)
+	unsigned := writeChain("unsigned", keyPath, 0, 2)
+	forged := writeChain("forged", filepath.Join(dir, "other.key"), time.Hour, 2)
+
+	publicKey, err := LoadAuditPublicKey(keyPath + ".pub")
+	assert.NoError(t, err)
+
+	// a checkpoint starts every chain, the records of a chain restarted without one could follow a truncation
+	tests := []struct {
+		name     string
+		content  string
+		key      ed25519.PublicKey
+		restarts int
+		expected string
+	}{
+		{"signed restart", first + signed, publicKey, 1, ""},
+		{"unsigned restart", first + unsigned, publicKey, 0, "unsigned restart:5: record 1: chain starts over without a signed checkpoint"},
+		{"forged restart", first + forged, publicKey, 0, "forged restart:5: record 1: checkpoint signature is invalid"},
+		{"restart without key", first + signed, nil, 0, "restart without key:5: record 1: chain starts over without a signed checkpoint"},
+		{"unsigned start", unsigned, publicKey, 0, "record 1: chain starts over without a signed checkpoint"},
+		{"unsigned start without key", unsigned, nil, 0, ""},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		assert.NoError(t, ioutil.WriteFile(path, []byte(test.content), 0600))
+		verifier := NewAuditVerifier(test.key)
+		err := verifier.Verify(path)
+		if test.expected == "" {
+			assert.NoError(t, err, test.name)
+			assert.Equal(t, test.restarts, verifier.Restarts, test.name)
+			continue
+		}
+		if assert.Error(t, err, test.name) {
+			assert.Contains(t, err.Error(), test.expected, test.name)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AuthzMemory/core"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// maxActionSuggestions bounds the known actions suggested for an unknown action
+	maxActionSuggestions = 5
+	// maxActionTypos is the edit distance under which a known action is suggested for an unknown one
+	maxActionTypos = 2
+)
+
+// AuditQuery selects audit records, every empty criteria matches anything
+type AuditQuery struct {
+	Since      time.Time // Since excludes the records before this time
+	Until      time.Time // Until excludes the records after this time
+	User       string    // User is the user of the records
+	Tenant     string    // Tenant is the tenant of the records
+	Actions    []string  // Actions are the action patterns of the records (e.g. "container_*")
+	ResourceID string    // ResourceID is a prefix of the resource id of the records
+	Decision   string    // Decision is the decision of the records (allow, deny, error, abstain)
+}
+
+// Validate checks the actions and decision of the query are known
+func (q *AuditQuery) Validate() error {
+	actions := core.Actions()
+	for _, pattern := range q.Actions {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid action pattern %q: %v", pattern, err)
+		}
+		matched := false
+		for _, action := range actions {
+			if ok, _ := path.Match(pattern, action); ok {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		if suggestions := suggestActions(pattern, actions); len(suggestions) > 0 {
+			return fmt.Errorf("Unknown action %q, did you mean %s?", pattern, strings.Join(suggestions, ", "))
+		}
+		return fmt.Errorf("Unknown action %q", pattern)
+	}
+	switch q.Decision {
+	case "", core.DecisionAllow, core.DecisionDeny, core.DecisionError, core.DecisionAbstain:
+		return nil
+	}
+	return fmt.Errorf("Unknown decision %q", q.Decision)
+}
+
+// suggestion is a known action close to an unknown one
+type suggestion struct {
+	action   string
+	distance int
+}
+
+// byDistance sorts suggestions closest first
+type byDistance []suggestion
+
+func (s byDistance) Len() int      { return len(s) }
+func (s byDistance) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDistance) Less(i, j int) bool {
+	if s[i].distance != s[j].distance {
+		return s[i].distance < s[j].distance
+	}
+	return s[i].action < s[j].action
+}
+
+// suggestActions returns the known actions closest to an unknown action, those containing it or within
+// a few typos of it
+func suggestActions(pattern string, actions []string) []string {
+	literal := strings.Trim(pattern, "*?")
+	var candidates []suggestion
+	for _, action := range actions {
+		distance := editDistance(literal, action)
+		if strings.Contains(action, literal) || distance <= maxActionTypos {
+			candidates = append(candidates, suggestion{action, distance})
+		}
+	}
+	sort.Sort(byDistance(candidates))
+	var suggestions []string
+	for i := 0; i < len(candidates) && i < maxActionSuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].action)
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Matches returns whether the record is selected by the query, checkpoints never are
+func (q *AuditQuery) Matches(record *core.AuditRecord) bool {
+	switch {
+	case record.Phase == core.AuditPhaseCheckpoint:
+		return false
+	case !q.Since.IsZero() && record.Timestamp.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && record.Timestamp.After(q.Until):
+		return false
+	case q.User != "" && record.User != q.User:
+		return false
+	case q.Tenant != "" && record.Tenant != q.Tenant:
+		return false
+	case q.ResourceID != "" && !strings.HasPrefix(record.ResourceID, q.ResourceID):
+		return false
+	case q.Decision != "" && record.Decision != q.Decision:
+		return false
+	}
+	return len(q.Actions) == 0 || matchesAny(q.Actions, record.Action)
+}
+
+// SearchAuditLog returns the records of the audit log files, plain or gzipped, selected by the query,
+// malformed records (e.g. a record being written) are skipped
+func SearchAuditLog(files []string, query *AuditQuery) ([]core.AuditRecord, error) {
+	var records []core.AuditRecord
+	for _, file := range files {
+		reader, err := openAuditFile(file)
+		if err != nil {
+			return nil, err
+		}
+		scanner := newAuditScanner(reader)
+		line := 0
+		for scanner.Scan() {
+			line++
+			if len(strings.TrimSpace(scanner.Text())) == 0 {
+				continue
+			}
+			var record core.AuditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				logrus.Warnf("Skipping malformed audit record %s:%d: %v", file, line, err)
+				continue
+			}
+			if query.Matches(&record) {
+				records = append(records, record)
+			}
+		}
+		err = scanner.Err()
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
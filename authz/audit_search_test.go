@@ -0,0 +1,104 @@
+package authz
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AuthzMemory/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditSearch(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "authz-broker.log")
+
+	// a small maximum size rotates the log into gzipped files every few records
+	auditor := NewBasicAuditor(&BasicAuditorSettings{LogHook: AuditHookFile, LogPath: path, MaxSize: 1024, MaxBackups: 10, Compress: true})
+	assert.NoError(t, auditor.Init())
+	start := time.Date(2016, 6, 1, 12, 0, 0, 0, time.UTC)
+	records := []core.AuditRecord{
+		{User: "alice", Tenant: "team-a", Action: core.ActionContainerCreate, Decision: core.DecisionAllow},
+		{User: "alice", Tenant: "team-a", Action: core.ActionContainerStart, ResourceID: "4fa6e0f0c678", Decision: core.DecisionAllow},
+		{User: "bob", Tenant: "team-b", Action: core.ActionContainerCreate, Decision: core.DecisionDeny},
+		{User: "bob", Tenant: "team-b", Action: core.ActionServiceCreate, Decision: core.DecisionDeny},
+		{User: "carol", Tenant: "team-a", Action: core.ActionContainerDelete, ResourceID: "4fa6e0f0c678", Decision: core.DecisionAllow},
+		{User: "carol", Tenant: "team-a", Action: core.ActionImageBuild, Decision: core.DecisionError},
+	}
+	for i := range records {
+		records[i].Timestamp = start.Add(time.Duration(i) * time.Hour)
+		records[i].Phase = core.AuditPhaseRequest
+		records[i].Method = "POST"
+		records[i].URI = "/v1.24/containers/create?name=a-container-name-long-enough-to-rotate-the-audit-log-quickly"
+		record := records[i]
+		assert.NoError(t, auditor.Audit(&record))
+	}
+
+	files, err := AuditLogFiles(path)
+	assert.NoError(t, err)
+	assert.True(t, len(files) > 1, "the audit log was not rotated")
+	assert.Equal(t, path+".1.gz", files[len(files)-2])
+
+	tests := []struct {
+		name     string
+		query    AuditQuery
+		expected []int
+	}{
+		{"all", AuditQuery{}, []int{0, 1, 2, 3, 4, 5}},
+		{"since", AuditQuery{Since: start.Add(4 * time.Hour)}, []int{4, 5}},
+		{"until", AuditQuery{Until: start.Add(time.Hour)}, []int{0, 1}},
+		{"user", AuditQuery{User: "bob"}, []int{2, 3}},
+		{"tenant", AuditQuery{Tenant: "team-a"}, []int{0, 1, 4, 5}},
+		{"action", AuditQuery{Actions: []string{core.ActionContainerCreate}}, []int{0, 2}},
+		{"action pattern", AuditQuery{Actions: []string{"*_create", core.ActionImageBuild}}, []int{0, 2, 3, 5}},
+		{"resource prefix", AuditQuery{ResourceID: "4fa6"}, []int{1, 4}},
+		{"decision", AuditQuery{Decision: core.DecisionDeny}, []int{2, 3}},
+		{"combined", AuditQuery{Tenant: "team-a", Decision: core.DecisionAllow, Since: start.Add(time.Hour)}, []int{1, 4}},
+		{"none", AuditQuery{User: "dave"}, nil},
+	}
+
+	for _, test := range tests {
+		found, err := SearchAuditLog(files, &test.query)
+		assert.NoError(t, err, test.name)
+		var actual []string
+		for _, record := range found {
+			actual = append(actual, record.User+" "+record.Action)
+		}
+		var expected []string
+		for _, i := range test.expected {
+			expected = append(expected, records[i].User+" "+records[i].Action)
+		}
+		assert.Equal(t, expected, actual, test.name)
+	}
+}
+
+func TestAuditQueryValidate(t *testing.T) {
+
+	tests := []struct {
+		query    AuditQuery
+		expected string
+	}{
+		{AuditQuery{Actions: []string{core.ActionContainerCreate, "service_*"}, Decision: core.DecisionDeny}, ""},
+		{AuditQuery{Actions: []string{"container_creat"}}, `Unknown action "container_creat", did you mean container_create?`},
+		{AuditQuery{Actions: []string{"container_strt"}}, `Unknown action "container_strt", did you mean container_start, container_stats, container_stop?`},
+		{AuditQuery{Actions: []string{"spaceship_launch"}}, `Unknown action "spaceship_launch"`},
+		{AuditQuery{Actions: []string{"container_[create"}}, `Invalid action pattern "container_[create": syntax error in pattern`},
+		{AuditQuery{Decision: "maybe"}, `Unknown decision "maybe"`},
+	}
+
+	for _, test := range tests {
+		err := test.query.Validate()
+		if test.expected == "" {
+			assert.NoError(t, err)
+			continue
+		}
+		if assert.Error(t, err) {
+			assert.Equal(t, test.expected, err.Error())
+		}
+	}
+}
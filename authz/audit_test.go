@@ -0,0 +1,84 @@
+package authz
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AuthzMemory/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactBody(t *testing.T) {
+
+	body := json.RawMessage(`{"Image":"busybox","Env":["PATH=/bin","DB_PASSWORD=hunter2"],"HostConfig":{"Privileged":true},` +
+		`"Spec":{"Auth":{"Password":"x"},"RegistryToken":"t"}}`)
+
+	tests := []struct {
+		redaction string
+		expected  string
+	}{
+		{BodyRedactionNone, string(body)},
+		{BodyRedactionAll, ``},
+		{BodyRedactionSensitive, `{"Env":["PATH=<redacted>","DB_PASSWORD=<redacted>"],"HostConfig":{"Privileged":true},` +
+			`"Image":"busybox","Spec":{"Auth":{"Password":"<redacted>"},"RegistryToken":"<redacted>"}}`},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, string(redactBody(body, test.redaction)), test.redaction)
+	}
+
+	// the daemon decodes the field names case insensitively
+	lowercase := json.RawMessage(`{"image":"busybox","env":["DB_PASSWORD=hunter2"],"ENV":["TOKEN=t"]}`)
+	assert.Equal(t, `{"ENV":["TOKEN=<redacted>"],"env":["DB_PASSWORD=<redacted>"],"image":"busybox"}`,
+		string(redactBody(lowercase, BodyRedactionSensitive)))
+
+	assert.EqualError(t, validateBodyRedaction("some"), `Unknown body redaction "some"`)
+}
+
+func TestAuditLog(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit", "authz-broker.log")
+
+	auditor := NewBasicAuditor(&BasicAuditorSettings{LogHook: AuditHookFile, LogPath: path, MaxSize: 400, MaxBackups: 2, Compress: true})
+	assert.NoError(t, auditor.Init())
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, auditor.Audit(&core.AuditRecord{
+			Phase:    core.AuditPhaseRequest,
+			Method:   "POST",
+			URI:      "/v1.24/containers/create",
+			Action:   core.ActionContainerCreate,
+			Decision: core.DecisionAllow,
+			Body:     json.RawMessage(`{"Env":["SECRET=1"]}`),
+		}))
+	}
+
+	files, err := filepath.Glob(path + "*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{path, path + ".1.gz", path + ".2.gz"}, files)
+
+	file, err := os.Open(path + ".1.gz")
+	assert.NoError(t, err)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	assert.NoError(t, err)
+	scanner := bufio.NewScanner(reader)
+	lines := 0
+	for scanner.Scan() {
+		var record core.AuditRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		assert.Equal(t, core.ActionContainerCreate, record.Action)
+		assert.Equal(t, `{"Env":["SECRET=<redacted>"]}`, string(record.Body))
+		lines++
+	}
+	assert.True(t, lines > 0)
+
+	assert.Error(t, NewBasicAuditor(&BasicAuditorSettings{LogHook: "kafka"}).Init())
+}
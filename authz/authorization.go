@@ -2,8 +2,11 @@ package authz
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/AuthzMemory/core"
@@ -11,197 +14,544 @@ import (
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/pkg/authorization"
 
-	//	"fmt"
-
 	"github.com/docker/engine-api/client"
 	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/container"
+	"github.com/docker/engine-api/types/swarm"
 	"golang.org/x/net/context"
 )
 
-const (
+type basicAuthorizer struct {
+	settings *BasicAuthorizerSettings
+	ledger   *ledger
+	sampler  *usageSampler
+	ooms     *oomTracker
+	usage    *imageUsage
 
-	// AuditHookStdout indicates logs are streamed to stdout
-	AuditHookStdout = ""
-)
+	allowedRoutes []routePattern   // allowedRoutes are the unknown routes exempted from the unknown route policy
+	unmatched     *unmatchedRoutes // unmatched counts the requests matching no known route
 
-// defaultAuditLogPath is the file test hook log path
-const defaultAuditLogPath = "/var/log/authz-broker.log"
+	currentPolicy atomic.Value  // currentPolicy holds the *Policy loaded from the policy file
+	wouldDeny     *wouldDenials // wouldDeny counts the requests allowed in audit mode that would have been denied
+	hostMemory    int64         // hostMemory is the memory reported by the daemon, set once connected
 
-type basicAuthorizer struct {
-	settings *BasicAuthorizerSettings
+	cli         *client.Client // cli is the docker client, set once connected
+	initialized int32          // initialized is set once the first request triggered the connection to the daemon
 }
 
 // BasicAuthorizerSettings provides settings for the basic authoerizer flow
 type BasicAuthorizerSettings struct {
+	MemoryModel       string // MemoryModel defines how the cost of a container is computed
+	CountKernelMemory bool   // CountKernelMemory charges the kernel memory limit on top of the memory limit
+	QoS               bool   // QoS enables admission by QoS class derived from the memory reservation and limit
+	BurstCapacity     int64  // BurstCapacity is the capacity for the sum of limits of QoS containers, defaults to the host memory
+	BestEffortPool    int64  // BestEffortPool is the capacity shared by best effort containers
+	BestEffortCharge  int64  // BestEffortCharge is the amount charged to the best effort pool for every best effort container
+
+	UsageAware         bool          // UsageAware admits containers against their observed usage instead of their limits
+	UsageHeadroom      int64         // UsageHeadroom is added to the observed usage peak of every container
+	StatsInterval      time.Duration // StatsInterval is the delay between two usage sampling rounds
+	StatsMaxContainers int           // StatsMaxContainers bounds the number of containers sampled in a round
+	StatsWindow        int           // StatsWindow is the number of samples the usage peak is computed over
+
+	MeminfoPath           string  // MeminfoPath is the host memory information file, defaults to /proc/meminfo
+	PressurePath          string  // PressurePath is the host memory pressure file, defaults to /proc/pressure/memory
+	PressureWindow        string  // PressureWindow is the PSI average compared with the thresholds (avg10, avg60, avg300)
+	PressureSomeThreshold float64 // PressureSomeThreshold denies memory consuming actions above this "some" PSI percentage
+	PressureFullThreshold float64 // PressureFullThreshold denies memory consuming actions above this "full" PSI percentage
+	MinMemAvailable       int64   // MinMemAvailable denies memory consuming actions while MemAvailable is below it
+
+	MemoryCapacity int64  // MemoryCapacity overrides the memory available for containers, defaults to the host memory
+	CgroupAware    bool   // CgroupAware bounds capacity by the cgroup limits and checks containers against their cgroup parent limit
+	CgroupRoot     string // CgroupRoot is where the cgroup hierarchy is mounted, defaults to /sys/fs/cgroup
+	CgroupPath     string // CgroupPath is the cgroup containers run under when they set no cgroup parent, defaults to docker
+
+	OOMRepeatCount int           // OOMRepeatCount denies creating an image OOM killed this many times with a limit not above the failed ones
+	OOMWindow      time.Duration // OOMWindow is the period OOM kills are counted over
+
+	Recommendations bool // Recommendations learns the memory usage of every image to recommend memory limits
+	RecommendInDeny bool // RecommendInDeny includes the recommended memory limit in container create deny messages
+
+	ImageRules []ImageRule // ImageRules set memory limits per image, the first matching rule applies
+
+	EnforceDefaultLimit bool                  // EnforceDefaultLimit applies a default memory limit to containers created without one
+	DefaultMemoryLimit  int64                 // DefaultMemoryLimit is applied when no image rule or tenant default applies
+	TenantDefaultLimits map[string]MemorySize // TenantDefaultLimits are the default memory limits by tenant
+
+	SweepInterval   time.Duration // SweepInterval is the delay between two policy violation sweeps, zero disables sweeping
+	SweepAction     string        // SweepAction is taken on containers violating the policy (log, pause, stop, update)
+	SweepDryRun     bool          // SweepDryRun only logs the actions a sweep would take
+	SweepMaxActions int           // SweepMaxActions bounds the actions taken by a single sweep
+
+	BodyUnavailablePolicy string // BodyUnavailablePolicy handles container creates whose body the daemon did not forward (deny, verify)
+
+	UnknownRoutePolicy    string   // UnknownRoutePolicy handles the requests matching no known route (allow, deny, audit)
+	UnknownRouteAllowlist []string // UnknownRouteAllowlist are the "METHOD /path" globs allowed whatever the unknown route policy
+
+	PolicyFile         string        // PolicyFile is the JSON policy reloaded on SIGHUP and on change, empty for no policy
+	PolicyPollInterval time.Duration // PolicyPollInterval is the delay between two checks of the policy file modification time
+
+	EnforcementMode string // EnforcementMode is enforce, or audit to only log and count the requests that would be denied
+}
+
+// createRequest is the body of a container create request
+type createRequest struct {
+	container.Config
+	HostConfig *container.HostConfig
 }
 
-var memoryLimit int64
-var currentMemory float64
-var cli *client.Client
-var memoryPerID map[string]int64
+// reconcileInterval is the delay between two reconciliations of the ledger with the listed containers
+const reconcileInterval = 30 * time.Second
+
+// eventStreamRetryDelay is the delay before reconnecting to the docker event stream
+var eventStreamRetryDelay = 5 * time.Second
 
 // NewBasicAuthZAuthorizer creates a new basic authorizer
-func NewBasicAuthZAuthorizer(settings *BasicAuthorizerSettings) core.Authorizer {
+func NewBasicAuthZAuthorizer(settings *BasicAuthorizerSettings) core.AuthorizerV2 {
 	return &basicAuthorizer{settings: settings}
 }
 
 // Init loads the basic authz plugin configuration from disk
 func (f *basicAuthorizer) Init() error {
-	currentMemory = 0.0
-	memoryLimit = 0
+	if f.settings.MemoryModel == "" {
+		f.settings.MemoryModel = MemoryModelLimit
+	}
+	if err := validateMemoryModel(f.settings.MemoryModel); err != nil {
+		return err
+	}
+	if err := compileImageRules(f.settings.ImageRules); err != nil {
+		return err
+	}
+	if f.settings.BodyUnavailablePolicy == "" {
+		f.settings.BodyUnavailablePolicy = BodyUnavailableVerify
+	}
+	if err := validateBodyUnavailablePolicy(f.settings.BodyUnavailablePolicy); err != nil {
+		return err
+	}
+	if f.settings.SweepAction == "" {
+		f.settings.SweepAction = SweepActionLog
+	}
+	if err := validateSweepAction(f.settings.SweepAction); err != nil {
+		return err
+	}
+	if f.settings.UnknownRoutePolicy == "" {
+		f.settings.UnknownRoutePolicy = UnknownRouteDeny
+	}
+	if err := validateUnknownRoutePolicy(f.settings.UnknownRoutePolicy); err != nil {
+		return err
+	}
+	if f.settings.EnforcementMode == "" {
+		f.settings.EnforcementMode = EnforcementEnforce
+	}
+	if err := validateEnforcementMode(f.settings.EnforcementMode); err != nil {
+		return err
+	}
+	allowedRoutes, err := compileRoutePatterns(f.settings.UnknownRouteAllowlist)
+	if err != nil {
+		return err
+	}
+	f.allowedRoutes = allowedRoutes
+	f.unmatched = newUnmatchedRoutes()
+	f.wouldDeny = newWouldDenials()
+	f.ledger = newLedger()
+	setMeteredLedger(f.ledger)
+	f.ooms = newOOMTracker()
+	if f.settings.UsageAware || f.settings.Recommendations {
+		f.sampler = newUsageSampler(f.settings.StatsWindow)
+	}
+	if f.settings.Recommendations {
+		f.usage = newImageUsage()
+	}
+	if f.settings.PolicyFile != "" {
+		policy, err := LoadPolicy(f.settings.PolicyFile)
+		if err != nil {
+			return err
+		}
+		f.applyPolicy(policy)
+		go f.watchPolicy()
+	}
 	return nil
 }
 
-func initializeOnFirstCall() error {
-	memoryPerID = make(map[string]int64)
-	defaultHeaders := map[string]string{"User-Agent": "engine-api-cli-1.0", AuthZTenantIDHeaderName: "infoTenantInternal"}
+// configuredCapacity returns the capacities set by the policy, falling back to the settings
+func (f *basicAuthorizer) configuredCapacity() containerCost {
+	configured := containerCost{
+		Memory:     f.settings.MemoryCapacity,
+		Burst:      f.settings.BurstCapacity,
+		BestEffort: f.settings.BestEffortPool,
+	}
+	if policy := f.policy(); policy != nil {
+		if policy.Capacity.Memory > 0 {
+			configured.Memory = int64(policy.Capacity.Memory)
+		}
+		if policy.Capacity.Burst > 0 {
+			configured.Burst = int64(policy.Capacity.Burst)
+		}
+		if policy.Capacity.BestEffortPool > 0 {
+			configured.BestEffort = int64(policy.Capacity.BestEffortPool)
+		}
+	}
+	return configured
+}
+
+// applyCapacity computes the capacity available for containers and sets it in the ledger,
+// it does nothing until the daemon reported the host memory
+func (f *basicAuthorizer) applyCapacity() {
+	hostMemory := atomic.LoadInt64(&f.hostMemory)
+	if hostMemory == 0 {
+		return
+	}
+	configured := f.configuredCapacity()
+	capacity := containerCost{Memory: hostMemory}
+	if configured.Memory > 0 {
+		capacity.Memory = configured.Memory
+	}
+	if f.settings.CgroupAware {
+		capacity = f.cgroupCapacity(capacity, configured)
+	}
+	if f.settings.QoS {
+		capacity.Burst = configured.Burst
+		if capacity.Burst == 0 {
+			capacity.Burst = capacity.Memory
+		}
+		capacity.BestEffort = configured.BestEffort
+	}
+	if f.settings.MemoryModel == MemoryModelSwap {
+		meminfo, err := readMeminfo(f.meminfoPath())
+		if err != nil {
+			logrus.Errorf("Failed to read host swap total: %v", err)
+		}
+		capacity.Swap = meminfo["SwapTotal"]
+	}
+	f.ledger.setCapacity(capacity)
+}
+
+// initializeOnFirstCall connects to the daemon, reads the host memory and starts the goroutines keeping
+// the ledger in line with the daemon, it fails while the daemon is unreachable
+func (f *basicAuthorizer) initializeOnFirstCall() error {
+	defaultHeaders := map[string]string{"User-Agent": "engine-api-cli-1.0", core.TenantIDHeaderName: "infoTenantInternal"}
 	var err error
-	cli, err = client.NewClient("unix:///var/run/docker.sock", "v1.24", nil, defaultHeaders)
+	f.cli, err = client.NewClient("unix:///var/run/docker.sock", "v1.24", nil, defaultHeaders)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.cli.Info(context.Background())
 	if err != nil {
-		panic(err)
+		countDockerError(dockerInfo, err)
+		return err
 	}
 
-	info, err := cli.Info(context.Background())
-	memoryLimit = info.MemTotal
+	atomic.StoreInt64(&f.hostMemory, info.MemTotal)
+	f.applyCapacity()
 
+	connected := time.Now()
+	responseBody, err := f.cli.Events(context.Background(), types.EventsOptions{})
 	if err != nil {
-		panic(err)
+		countDockerError(dockerEvents, err)
+		return err
 	}
+	go f.watchEvents(responseBody, connected)
+	go f.reconcile()
 
-	type decodingResult struct {
-		msg events.Message
-		err error
+	if f.sampler != nil {
+		go f.sampleUsage()
 	}
+	if f.settings.SweepInterval > 0 {
+		go f.sweep()
+	}
+	return nil
+}
 
-	stopChan := make(chan struct{})
-	responseBody, err := cli.Events(context.Background(), types.EventsOptions{})
-	if err != nil {
-		panic(err)
-	}
-	resultChan := make(chan decodingResult)
-
-	go func() {
-		dec := json.NewDecoder(responseBody)
-		for {
-			var result decodingResult
-			result.err = dec.Decode(&result.msg)
-			resultChan <- result
-			if result.err == io.EOF {
-				break
-			}
+// watchEvents applies the container events of the stream to the ledger, reconnecting to the event stream
+// whenever it ends or fails and resuming from the last event received
+func (f *basicAuthorizer) watchEvents(stream io.ReadCloser, since time.Time) {
+	for {
+		err := f.handleEvents(stream, &since)
+		stream.Close()
+		logrus.Warnf("Docker event stream ended (%v), reconnecting in %s", err, eventStreamRetryDelay)
+		stream = f.reconnectEvents(since)
+	}
+}
+
+// reconnectEvents reconnects to the docker event stream until it succeeds, the events after the given time are
+// replayed so that the containers created or destroyed while disconnected reach the ledger. The daemon replays
+// the events at the since time too, so the stream resumes a nanosecond after the last event handled
+func (f *basicAuthorizer) reconnectEvents(last time.Time) io.ReadCloser {
+	since := last.Add(time.Nanosecond)
+	options := types.EventsOptions{Since: fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())}
+	for {
+		time.Sleep(eventStreamRetryDelay)
+		eventStreamReconnects.Inc()
+		stream, err := f.cli.Events(context.Background(), options)
+		if err == nil {
+			return stream
 		}
-		close(resultChan)
-	}()
-
-	go func() {
-		defer responseBody.Close()
-		for {
-			select {
-			case <-stopChan:
-				// ec <- nil
-				return
-			case result := <-resultChan:
-				if result.err != nil {
-					// ec <- result.err
-					return
-				}
-				logrus.Debug(result.msg)
-
-				if result.msg.Action == "create" && result.msg.Type == "container" {
-					memoryPerID[result.msg.ID] = 0
-					cJSON, _ := cli.ContainerInspect(context.Background(), result.msg.ID)
-
-					if cJSON.ContainerJSONBase != nil && cJSON.ContainerJSONBase.HostConfig != nil {
-						memoryPerID[result.msg.ID] = cJSON.ContainerJSONBase.HostConfig.Memory
-					}
-
-				} else if result.msg.Action == "destroy" && result.msg.Type == "container" {
-					currentMemory -= float64(memoryPerID[result.msg.ID])
-					delete(memoryPerID, result.msg.ID)
-				}
-			}
+		countDockerError(dockerEvents, err)
+		logrus.Warnf("Failed to reconnect to the docker event stream (%v), retrying in %s", err, eventStreamRetryDelay)
+	}
+}
+
+// handleEvents decodes the event stream until it ends, applying the container events to the ledger
+// and advancing last to the time of every event, events not after last were already handled (e.g. OOM kills
+// would count twice) and are skipped
+func (f *basicAuthorizer) handleEvents(stream io.Reader, last *time.Time) error {
+	dec := json.NewDecoder(stream)
+	for {
+		var msg events.Message
+		if err := dec.Decode(&msg); err != nil {
+			return err
+		}
+		logrus.Debug(msg)
+		if msg.TimeNano != 0 && !last.IsZero() && msg.TimeNano <= last.UnixNano() {
+			logrus.Debugf("Skipping replayed %s event of %s %s", msg.Action, msg.Type, msg.ID)
+			continue
+		}
+		if msg.TimeNano != 0 {
+			*last = time.Unix(0, msg.TimeNano)
+		} else if msg.Time != 0 && time.Unix(msg.Time, 0).After(*last) {
+			*last = time.Unix(msg.Time, 0)
 		}
-	}()
 
-	go func() {
-		for {
+		if msg.Action == "create" && msg.Type == "container" {
+			var entry ledgerEntry
+			cJSON, err := f.cli.ContainerInspect(context.Background(), msg.ID)
+			countDockerError(dockerContainerInspect, err)
 
-			options := types.ContainerListOptions{All: true}
-			containers, err := cli.ContainerList(context.Background(), options)
-			if err != nil {
-				panic(err)
+			if cJSON.ContainerJSONBase != nil && cJSON.ContainerJSONBase.HostConfig != nil {
+				entry = f.entryOf(msg.ID, cJSON.ContainerJSONBase.HostConfig.Resources)
 			}
-			var tmp int64
-			for _, c := range containers {
-				cJSON, _ := cli.ContainerInspect(context.Background(), c.ID)
+			f.ledger.record(msg.ID, entry)
 
-				if cJSON.ContainerJSONBase != nil && cJSON.ContainerJSONBase.HostConfig != nil {
-					tmp += cJSON.ContainerJSONBase.HostConfig.Memory
-					if cJSON.ContainerJSONBase.HostConfig.Memory == 0 {
-						logrus.Infof("Warning no memory accounted for container %s ", cJSON.ID)
-					}
-				}
+		} else if msg.Action == "destroy" && msg.Type == "container" {
+			f.ledger.release(msg.ID)
+			if f.sampler != nil {
+				f.sampler.forget(msg.ID)
+			}
+			core.RemoveResourceTenant(msg.ID)
+		} else if (msg.Action == "oom" || msg.Action == "die") && msg.Type == "container" {
+			f.handleOOMEvent(msg)
+		}
+	}
+}
+
+// reconcile periodically replaces the ledger with the cost of the containers listed by the daemon
+func (f *basicAuthorizer) reconcile() {
+	for {
+		f.reconcileOnce()
+		time.Sleep(reconcileInterval)
+	}
+}
 
+// reconcileOnce replaces the ledger with the cost of the containers listed by the daemon, recording how far off
+// the memory committed to known containers was, the admissions of containers not created yet are not drift
+func (f *basicAuthorizer) reconcileOnce() {
+	options := types.ContainerListOptions{All: true}
+	containers, err := f.cli.ContainerList(context.Background(), options)
+	if err != nil {
+		countDockerError(dockerContainerList, err)
+		logrus.Errorf("Failed to list containers for reconciliation: %v", err)
+		return
+	}
+	var tmp containerCost
+	entries := make(map[string]ledgerEntry)
+	for _, c := range containers {
+		cJSON, err := f.cli.ContainerInspect(context.Background(), c.ID)
+		countDockerError(dockerContainerInspect, err)
+
+		if cJSON.ContainerJSONBase != nil && cJSON.ContainerJSONBase.HostConfig != nil {
+			entries[c.ID] = f.entryOf(c.ID, cJSON.ContainerJSONBase.HostConfig.Resources)
+			if f.usage != nil {
+				f.usage.declare(imageKey(c.Image), cJSON.ContainerJSONBase.HostConfig.Memory)
+			}
+			tmp = tmp.add(entries[c.ID].Cost)
+			if cJSON.ContainerJSONBase.HostConfig.Memory == 0 {
+				logrus.Infof("Warning no memory accounted for container %s ", cJSON.ID)
 			}
-			logrus.Info("Current memory used: " + strconv.FormatInt(int64(tmp), 10))
-			currentMemory = float64(tmp)
-			time.Sleep(30 * time.Second)
 		}
-	}()
-	return nil
+
+	}
+	logrus.Info("Current memory used: " + strconv.FormatInt(tmp.Memory, 10) + " swap used: " + strconv.FormatInt(tmp.Swap, 10))
+	host, _ := f.ledger.memoryUsage()
+	reconcileDrift.Set(float64(host.Committed - tmp.Memory))
+	reconciles.Inc()
+	f.ledger.reset(entries)
+}
+
+// checkContainer evaluates the memory policy for a container of the given image and resources,
+// it returns an empty string when the container complies or the deny reason otherwise
+func (f *basicAuthorizer) checkContainer(image string, resources container.Resources) string {
+	if msg := f.checkResources(resources); msg != "" {
+		return msg
+	}
+	if msg := f.checkImageRules(image, resources.Memory); msg != "" {
+		return msg
+	}
+	return f.checkOOMHistory(image, resources.Memory)
 }
 
-//AuthZTenantIDHeaderName - TenantId HTPP header name.
-var AuthZTenantIDHeaderName = "X-Auth-Tenantid"
+// AuthZReq authorizes the requests of docker clients against the memory policy and the policy rules
+func (f *basicAuthorizer) AuthZReq(authZReq *core.RequestContext) *authorization.Response {
+	return f.AuthorizeRequest(context.Background(), authZReq).Response()
+}
 
-func (f *basicAuthorizer) AuthZReq(authZReq *authorization.Request) *authorization.Response {
-	if memoryLimit == 0 {
-		memoryLimit = 1 //Prevent infitine loop of querinying this plugin
-		initializeOnFirstCall()
+// AuthorizeRequest authorizes the request against the memory policy and the policy rules, denials carry
+// the failing check as reason and admitted creates the memory charged as cost. Once the context is done
+// the ledger is left untouched, the server has already failed the request
+func (f *basicAuthorizer) AuthorizeRequest(ctx context.Context, authZReq *core.RequestContext) core.Decision {
+	if atomic.CompareAndSwapInt32(&f.initialized, 0, 1) { //Prevent infitine loop of querinying this plugin
+		if err := f.initializeOnFirstCall(); err != nil {
+			// the next request retries
+			atomic.StoreInt32(&f.initialized, 0)
+			logrus.Errorf("Failed to connect to the docker daemon: %v", err)
+			return core.Decision{
+				Result:  core.DecisionError,
+				Reason:  core.ReasonError,
+				Message: fmt.Sprintf("Authorization plugin failed to connect to the docker daemon: %v", err),
+			}
+		}
 	}
 	// logrus.Infof("Received AuthZ request, method: '%s', url: '%s' , headers: '%s'", authZReq.RequestMethod, authZReq.RequestURI, authZReq.RequestHeaders)
 
-	action, _ := core.ParseRoute(authZReq.RequestMethod, authZReq.RequestURI)
+	action := authZReq.Action
+
+	if action == core.ActionNone {
+		if res := f.checkUnknownRoute(authZReq); res != nil {
+			if decision := f.deny(authZReq, checkUnknownRoute, res.Msg); !decision.Allowed() {
+				return decision
+			}
+		}
+	}
+
+	if rule, msg := f.checkPolicyRules(authZReq); msg != "" {
+		if decision := f.deny(authZReq, policyCheckPrefix+rule, msg); !decision.Allowed() {
+			return decision
+		}
+	}
+
+	if memoryConsumingActions[action] && f.pressureGateEnabled() {
+		if msg := f.checkPressure(); msg != "" {
+			if decision := f.deny(authZReq, checkMemoryPressure, msg); !decision.Allowed() {
+				return decision
+			}
+		}
+	}
+
+	if action == core.ActionContainerCreate && !authZReq.IsJSON() {
+		if f.settings.BodyUnavailablePolicy == BodyUnavailableDeny {
+			return f.deny(authZReq, checkBodyUnavailable, "Container create request body is unavailable to the authorization plugin (too large or not JSON)")
+		}
+		logrus.Infof("Container create request body unavailable, the created container will be verified")
+		return core.Allow()
+	}
 
 	if action == core.ActionContainerCreate {
-		var request interface{}
-		err := json.Unmarshal(authZReq.RequestBody, &request)
+		request, err := decodeCreateRequest(authZReq)
 		if err != nil {
 			logrus.Error(err)
 		}
-		m := request.(map[string]interface{})
-		// logrus.Info(m)
-		hostConfig := m["HostConfig"].(map[string]interface{})
-
-		memory := hostConfig["Memory"].(float64)
-//		if memory == 0.0 {
-//			return &authorization.Response{
-//				Allow: false,
-//				Msg:   "Must request Memory",
-//			}
-//		}
-		// logrus.Info(memory)
-		if float64(currentMemory)+memory < float64(memoryLimit) {
-			currentMemory += memory
-			return &authorization.Response{
-				Allow: true,
+		var resources container.Resources
+		if request.HostConfig != nil {
+			resources = request.HostConfig.Resources
+		}
+
+		if msg := f.checkContainer(request.Image, resources); msg != "" {
+			if decision := f.deny(authZReq, checkContainerPolicy, f.withRecommendation(msg, request.Image)); !decision.Allowed() {
+				return decision
 			}
 		}
-		return &authorization.Response{
-			Allow: false,
-			Msg:   "Not enough Memory",
+		entry := f.parentEntry(resources.CgroupParent, f.costOf(resources))
+		entry.Tenant = authZReq.Tenant
+		if ctx.Err() != nil {
+			return timedOut(authZReq)
+		}
+		if ok, msg := f.ledger.admit(entry); !ok {
+			if f.settings.QoS {
+				msg = fmt.Sprintf("%s for %s container", msg, qosClass(resources))
+			}
+			msg = fmt.Sprintf("%s [admission model: %s]", msg, f.admissionModel())
+			decision := f.deny(authZReq, checkMemoryCapacity, f.withRecommendation(msg, request.Image))
+			if decision.Allowed() {
+				// the container is created anyway, keep the ledger in line with what runs
+				f.ledger.charge(entry)
+				decision.Cost = entry.Cost.Memory
+			}
+			return decision
 		}
+		decision := core.Allow()
+		decision.Cost = entry.Cost.Memory
+		return decision
+	}
 
+	if action == core.ActionServiceCreate || action == core.ActionServiceUpdate {
+		var spec swarm.ServiceSpec
+		if err := json.Unmarshal(authZReq.RequestBody, &spec); err != nil {
+			logrus.Error(err)
+		}
+		var memory int64
+		if spec.TaskTemplate.Resources != nil && spec.TaskTemplate.Resources.Limits != nil {
+			memory = spec.TaskTemplate.Resources.Limits.MemoryBytes
+		}
+		if msg := f.checkImageRules(spec.TaskTemplate.ContainerSpec.Image, memory); msg != "" {
+			return f.deny(authZReq, checkServiceImageRule, msg)
+		}
 	}
 
-	return &authorization.Response{
-		Allow: true,
+	return core.Allow()
+}
+
+// ReleaseRequest refunds the admission of a container create another authorizer of the chain refused,
+// the container will not be created and its event never releases the admission
+func (f *basicAuthorizer) ReleaseRequest(authZReq *core.RequestContext, decision core.Decision) {
+	if authZReq.Action != core.ActionContainerCreate || decision.Cost == 0 {
+		return
+	}
+	request, err := decodeCreateRequest(authZReq)
+	if err != nil {
+		return
+	}
+	var resources container.Resources
+	if request.HostConfig != nil {
+		resources = request.HostConfig.Resources
 	}
+	entry := f.parentEntry(resources.CgroupParent, f.costOf(resources))
+	entry.Tenant = authZReq.Tenant
+	f.ledger.refund(entry)
 }
 
-// AuthZRes always allow responses from server
-func (f *basicAuthorizer) AuthZRes(authZReq *authorization.Request) *authorization.Response {
+// AuthZRes always allow responses from server, it records the tenant owning created containers
+// and applies the default memory limit to the ones created without a limit
+func (f *basicAuthorizer) AuthZRes(authZReq *core.RequestContext) *authorization.Response {
+	return f.AuthorizeResponse(context.Background(), authZReq).Response()
+}
+
+// AuthorizeResponse records the tenant owning created containers, verifies the ones created without
+// a forwarded body and applies the default memory limit to the ones created without a limit
+func (f *basicAuthorizer) AuthorizeResponse(ctx context.Context, authZReq *core.RequestContext) core.Decision {
+	action := authZReq.Action
+
+	if action == core.ActionContainerCreate && authZReq.ResponseStatusCode == http.StatusCreated {
+		var created types.ContainerCreateResponse
+		if err := json.Unmarshal(authZReq.ResponseBody, &created); err == nil && created.ID != "" {
+			core.SetResourceTenant(created.ID, authZReq.Tenant)
+			f.ledger.assignTenant(created.ID, authZReq.Tenant)
+			if !authZReq.IsJSON() {
+				return f.verifyCreated(ctx, authZReq, created.ID)
+			}
+			if f.settings.EnforceDefaultLimit {
+				f.enforceDefaultLimit(ctx, authZReq, created.ID)
+			}
+		}
+	}
 
-	return &authorization.Response{Allow: true}
+	return core.Allow()
+}
 
+// timedOut returns the decision of an authorization whose context is done before it mutated the ledger
+func timedOut(authZReq *core.RequestContext) core.Decision {
+	return core.Decision{
+		Result:  core.DecisionError,
+		Reason:  core.ReasonTimeout,
+		Message: fmt.Sprintf("Authorization of %s %s timed out", authZReq.RequestMethod, authZReq.RequestURI),
+	}
 }
@@ -0,0 +1,234 @@
+package authz
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AuthzMemory/core"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestAuthorizeRequestDecision(t *testing.T) {
+
+	policy := &Policy{Rules: []PolicyRule{
+		{Name: "no-latest", Effect: PolicyEffectDeny, Images: []string{"*:latest"}},
+	}}
+	assert.NoError(t, policy.validate())
+
+	tests := []struct {
+		mode     string
+		method   string
+		uri      string
+		body     string
+		decision core.Decision
+	}{
+		{EnforcementEnforce, "POST", "/v1.24/containers/create", `{"Image":"busybox:1","HostConfig":{"Memory":268435456}}`,
+			core.Decision{Result: core.DecisionAllow, Cost: 256 << 20}},
+		{EnforcementEnforce, "POST", "/v1.24/containers/create", `{"Image":"busybox:latest","HostConfig":{"Memory":268435456}}`,
+			core.Decision{Result: core.DecisionDeny, Reason: policyCheckPrefix + "no-latest", Rule: "no-latest", Message: `Request denied by policy rule "no-latest"`}},
+		{EnforcementEnforce, "POST", "/v1.24/containers/create", `{"Image":"busybox:1","HostConfig":{"Memory":2147483648}}`,
+			core.Decision{Result: core.DecisionDeny, Reason: checkMemoryCapacity, Message: "Not enough Memory [admission model: limits]"}},
+		{EnforcementEnforce, "GET", "/v1.25/secrets", ``,
+			core.Decision{Result: core.DecisionDeny, Reason: checkUnknownRoute, Message: "Unrecognised docker API route GET /secrets is denied by default"}},
+		{EnforcementEnforce, "GET", "/v1.24/containers/json", ``, core.Allow()},
+		{EnforcementAudit, "POST", "/v1.24/containers/create", `{"Image":"busybox:1","HostConfig":{"Memory":2147483648}}`,
+			core.Decision{Result: core.DecisionAllow, Cost: 2 << 30}},
+	}
+
+	for _, test := range tests {
+		f := connect(&basicAuthorizer{
+			settings:  &BasicAuthorizerSettings{MemoryModel: MemoryModelLimit, UnknownRoutePolicy: UnknownRouteDeny, EnforcementMode: test.mode},
+			unmatched: newUnmatchedRoutes(),
+			wouldDeny: newWouldDenials(),
+			ledger:    newLedger(),
+		}, nil)
+		f.applyPolicy(policy)
+		f.ledger.setCapacity(containerCost{Memory: 1 << 30})
+
+		decision := f.AuthorizeRequest(context.Background(), core.NewRequestContext(&authorization.Request{
+			RequestMethod: test.method,
+			RequestURI:    test.uri,
+			RequestBody:   []byte(test.body),
+		}))
+		assert.Equal(t, test.decision, decision, "%s %s %s", test.mode, test.uri, test.body)
+	}
+}
+
+func TestAuthorizeRequestDone(t *testing.T) {
+
+	f := connect(&basicAuthorizer{
+		settings:  &BasicAuthorizerSettings{MemoryModel: MemoryModelLimit},
+		wouldDeny: newWouldDenials(),
+		ledger:    newLedger(),
+	}, nil)
+	f.ledger.setCapacity(containerCost{Memory: 1 << 30})
+
+	// the server already failed the request, the ledger must not keep an admission for it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	decision := f.AuthorizeRequest(ctx, core.NewRequestContext(&authorization.Request{
+		RequestMethod: "POST",
+		RequestURI:    "/v1.24/containers/create",
+		RequestBody:   []byte(`{"Image":"busybox","HostConfig":{"Memory":268435456}}`),
+	}))
+	assert.Equal(t, core.DecisionError, decision.Result)
+	assert.Equal(t, core.ReasonTimeout, decision.Reason)
+	_, used := f.ledger.snapshot()
+	assert.Equal(t, int64(0), used.Memory)
+}
+
+func TestHandleEvents(t *testing.T) {
+
+	daemon := newFakeDaemon(t, map[string]string{
+		"GET /containers/a/json": `{"Id":"a","HostConfig":{"Memory":268435456},"Config":{"Image":"busybox"}}`,
+		"GET /containers/b/json": `{"Id":"b","HostConfig":{"Memory":536870912},"Config":{"Image":"busybox"}}`,
+	})
+	defer daemon.close()
+
+	f := connect(&basicAuthorizer{settings: &BasicAuthorizerSettings{MemoryModel: MemoryModelLimit}, ledger: newLedger()}, daemon)
+	f.ledger.record("c", ledgerEntry{Cost: containerCost{Memory: 1 << 30}})
+	stream := strings.NewReader(`{"Type":"container","Action":"create","id":"a","time":1476000000,"timeNano":1476000000000000001}
+{"Type":"container","Action":"create","id":"b","time":1476000001,"timeNano":1476000001000000002}
+{"Type":"network","Action":"create","id":"n","time":1476000002,"timeNano":1476000002000000003}
+{"Type":"container","Action":"destroy","id":"c","time":1476000003,"timeNano":1476000003000000004}
+`)
+	var last time.Time
+	assert.Equal(t, io.EOF, f.handleEvents(stream, &last))
+	assert.Equal(t, time.Unix(0, 1476000003000000004), last)
+
+	host, _ := f.ledger.memoryUsage()
+	assert.Equal(t, int64(256<<20+512<<20), host.Committed)
+	assert.Equal(t, []string{"GET /containers/a/json", "GET /containers/b/json"}, daemon.received())
+}
+
+func TestHandleEventsAfterCommit(t *testing.T) {
+
+	// the create event is handled after the default limit was committed, its inspection predates the update
+	daemon := newFakeDaemon(t, map[string]string{
+		"GET /containers/a/json": `{"Id":"a","HostConfig":{"Memory":268435456},"Config":{"Image":"busybox"}}`,
+	})
+	defer daemon.close()
+
+	f := connect(&basicAuthorizer{settings: &BasicAuthorizerSettings{MemoryModel: MemoryModelLimit}, ledger: newLedger()}, daemon)
+	f.ledger.setTenantQuotas(map[string]int64{"team-a": 1 << 30})
+	core.SetResourceTenant("a", "team-a")
+	defer core.RemoveResourceTenant("a")
+	f.ledger.commit("a", ledgerEntry{Cost: containerCost{Memory: 512 << 20}, Tenant: "team-a"})
+
+	var last time.Time
+	stream := strings.NewReader(`{"Type":"container","Action":"create","id":"a","time":1476000000,"timeNano":1476000000000000001}` + "\n")
+	assert.Equal(t, io.EOF, f.handleEvents(stream, &last))
+
+	_, used := f.ledger.snapshot()
+	assert.Equal(t, int64(256<<20), used.Memory)
+	host, _ := f.ledger.memoryUsage()
+	assert.Equal(t, memoryUsage{Committed: 256 << 20}, host)
+	tenantUsed, _ := f.ledger.tenantUsage("team-a")
+	assert.Equal(t, int64(256<<20), tenantUsed)
+}
+
+func TestReconnectEvents(t *testing.T) {
+
+	daemon := newFakeDaemon(t, map[string]string{
+		"GET /events": `{"Type":"container","Action":"destroy","id":"a","time":1476000005,"timeNano":1476000005000000000}`,
+	})
+	defer daemon.close()
+	defer func(delay time.Duration) { eventStreamRetryDelay = delay }(eventStreamRetryDelay)
+	eventStreamRetryDelay = time.Millisecond
+
+	f := connect(&basicAuthorizer{settings: &BasicAuthorizerSettings{}, ledger: newLedger()}, daemon)
+	f.ledger.record("a", ledgerEntry{Cost: containerCost{Memory: 1 << 30}})
+	reconnects := eventStreamReconnects.Value()
+
+	// the events missed while disconnected are replayed from the last event received
+	since := time.Unix(0, 1476000003000000004)
+	stream := f.reconnectEvents(since)
+	defer stream.Close()
+	assert.Equal(t, []string{"GET /events"}, daemon.received())
+	assert.Equal(t, "since=1476000003.000000005", daemon.queries[0])
+	assert.Equal(t, reconnects+1, eventStreamReconnects.Value())
+
+	assert.Equal(t, io.EOF, f.handleEvents(stream, &since))
+	assert.Equal(t, time.Unix(1476000005, 0), since)
+	host, _ := f.ledger.memoryUsage()
+	assert.Equal(t, int64(0), host.Committed)
+}
+
+func TestReplayedEvents(t *testing.T) {
+
+	daemon := newFakeDaemon(t, map[string]string{
+		"GET /containers/o/json": `{"Id":"o","State":{"OOMKilled":true},"HostConfig":{"Memory":268435456},"Config":{"Image":"redis"}}`,
+	})
+	defer daemon.close()
+
+	f := connect(&basicAuthorizer{settings: &BasicAuthorizerSettings{}, ledger: newLedger(), ooms: newOOMTracker()}, daemon)
+	// the first OOM kill was handled before the stream ended, the daemon replays it on reconnection
+	last := time.Unix(0, 1476000003000000004)
+	stream := strings.NewReader(`{"Type":"container","Action":"oom","id":"o","time":1476000003,"timeNano":1476000003000000004}
+{"Type":"container","Action":"oom","id":"o","time":1476000009,"timeNano":1476000009000000000}
+`)
+	assert.Equal(t, io.EOF, f.handleEvents(stream, &last))
+	assert.Equal(t, time.Unix(1476000009, 0), last)
+	assert.Equal(t, []string{"GET /containers/o/json"}, daemon.received())
+	assert.Equal(t, 1, f.ooms.summary("", "").ByImage["redis:latest"])
+}
+
+func TestReconcileDrift(t *testing.T) {
+
+	daemon := newFakeDaemon(t, map[string]string{
+		"GET /containers/json":   `[{"Id":"a","Image":"busybox"}]`,
+		"GET /containers/a/json": `{"Id":"a","HostConfig":{"Memory":268435456},"Config":{"Image":"busybox"}}`,
+	})
+	defer daemon.close()
+
+	f := connect(&basicAuthorizer{settings: &BasicAuthorizerSettings{MemoryModel: MemoryModelLimit}, ledger: newLedger()}, daemon)
+	f.ledger.setCapacity(containerCost{Memory: 8 << 30})
+	// a is known with a stale limit, another container was admitted and is not created yet
+	stale := ledgerEntry{Cost: containerCost{Memory: 512 << 20}}
+	ok, _ := f.ledger.admit(stale)
+	assert.True(t, ok)
+	f.ledger.record("a", stale)
+	ok, _ = f.ledger.admit(ledgerEntry{Cost: containerCost{Memory: 1 << 30}})
+	assert.True(t, ok)
+
+	f.reconcileOnce()
+	assert.Equal(t, float64(256<<20), reconcileDrift.Value())
+	host, _ := f.ledger.memoryUsage()
+	assert.Equal(t, memoryUsage{Committed: 256 << 20}, host)
+}
+
+func TestReleaseRequest(t *testing.T) {
+
+	f := connect(&basicAuthorizer{
+		settings:  &BasicAuthorizerSettings{MemoryModel: MemoryModelLimit},
+		wouldDeny: newWouldDenials(),
+		ledger:    newLedger(),
+	}, nil)
+	f.ledger.setCapacity(containerCost{Memory: 1 << 30})
+	f.ledger.setTenantQuotas(map[string]int64{"team-a": 512 << 20})
+
+	// another authorizer of the chain refused the create this one admitted
+	req := core.NewRequestContext(&authorization.Request{
+		RequestMethod:  "POST",
+		RequestURI:     "/v1.24/containers/create",
+		RequestBody:    []byte(`{"Image":"busybox","HostConfig":{"Memory":268435456}}`),
+		RequestHeaders: map[string]string{core.TenantIDHeaderName: "team-a"},
+	})
+	decision := f.AuthorizeRequest(context.Background(), req)
+	assert.Equal(t, int64(256<<20), decision.Cost)
+	f.ReleaseRequest(req, decision)
+
+	_, used := f.ledger.snapshot()
+	assert.Equal(t, int64(0), used.Memory)
+	tenantUsed, _ := f.ledger.tenantUsage("team-a")
+	assert.Equal(t, int64(0), tenantUsed)
+
+	// denied creates were never charged
+	f.ReleaseRequest(req, core.Deny(checkMemoryCapacity, "Not enough Memory"))
+	_, used = f.ledger.snapshot()
+	assert.Equal(t, int64(0), used.Memory)
+}
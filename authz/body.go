@@ -0,0 +1,71 @@
+package authz
+
+import (
+	"fmt"
+
+	"github.com/AuthzMemory/core"
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/engine-api/types"
+	"golang.org/x/net/context"
+)
+
+const (
+	// BodyUnavailableDeny denies container creates whose body the daemon did not forward
+	BodyUnavailableDeny = "deny"
+	// BodyUnavailableVerify allows container creates whose body the daemon did not forward,
+	// and verifies the created container, removing it if it violates the memory policy
+	BodyUnavailableVerify = "verify"
+)
+
+// validateBodyUnavailablePolicy validates the configured body unavailable policy name
+func validateBodyUnavailablePolicy(policy string) error {
+	switch policy {
+	case BodyUnavailableDeny, BodyUnavailableVerify:
+		return nil
+	}
+	return fmt.Errorf("Unknown body unavailable policy %q", policy)
+}
+
+// verifyCreated evaluates the memory policy on a container created without a forwarded body,
+// the container is removed and the response denied if it violates the policy or does not fit,
+// in audit mode the container is kept and the would-be denial recorded
+func (f *basicAuthorizer) verifyCreated(ctx context.Context, authZReq *core.RequestContext, id string) core.Decision {
+	cJSON, err := f.cli.ContainerInspect(ctx, id)
+	countDockerError(dockerContainerInspect, err)
+	if err != nil || cJSON.ContainerJSONBase == nil || cJSON.HostConfig == nil || cJSON.Config == nil {
+		logrus.Errorf("Failed to inspect container %s created without request body: %v", id, err)
+		return core.Allow()
+	}
+
+	resources := cJSON.HostConfig.Resources
+	entry := f.parentEntry(resources.CgroupParent, f.costOf(resources))
+	entry.Tenant = core.ResourceTenant(id)
+	if ctx.Err() != nil {
+		return timedOut(authZReq)
+	}
+	check, msg := checkContainerPolicy, f.checkContainer(cJSON.Config.Image, resources)
+	if msg == "" {
+		ok, admitMsg := f.ledger.admit(entry)
+		if ok {
+			decision := core.Allow()
+			decision.Cost = entry.Cost.Memory
+			return decision
+		}
+		check, msg = checkMemoryCapacity, fmt.Sprintf("%s [admission model: %s]", admitMsg, f.admissionModel())
+	}
+	if f.auditOnly() {
+		f.ledger.charge(entry)
+		f.wouldDeny.record(authZReq, check, msg)
+		decision := core.Allow()
+		decision.Cost = entry.Cost.Memory
+		return decision
+	}
+
+	if err := f.cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true}); err != nil {
+		countDockerError(dockerContainerRemove, err)
+		logrus.Errorf("Failed to remove container %s violating the memory policy: %v", id, err)
+	} else {
+		logrus.Warnf("Removed container %s created without request body: %s", id, msg)
+	}
+	return core.Deny(check, fmt.Sprintf("Container %s was removed: %s", id, msg))
+}
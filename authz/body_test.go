@@ -0,0 +1,38 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/AuthzMemory/core"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyUnavailable(t *testing.T) {
+
+	f := connect(&basicAuthorizer{settings: &BasicAuthorizerSettings{BodyUnavailablePolicy: BodyUnavailableDeny}}, nil)
+
+	tests := []struct {
+		body        string
+		contentType string
+		unavailable bool
+	}{
+		{"", "application/json", true},
+		{`{"Image":"busybox"}`, "text/plain", true},
+		{`{"Image":"busybox"}`, "application/json; charset=utf-8", false},
+		{`{"Image":"busybox"}`, "", false},
+	}
+
+	for _, test := range tests {
+		req := &authorization.Request{
+			RequestMethod:  "POST",
+			RequestURI:     "/v1.24/containers/create",
+			RequestBody:    []byte(test.body),
+			RequestHeaders: map[string]string{"Content-Type": test.contentType},
+		}
+		assert.Equal(t, test.unavailable, !core.NewRequestContext(req).IsJSON())
+		if test.unavailable {
+			assert.False(t, f.AuthZReq(core.NewRequestContext(req)).Allow)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package authz
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/go-units"
+)
+
+const (
+	// defaultCgroupRoot is where the cgroup hierarchy is mounted
+	defaultCgroupRoot = "/sys/fs/cgroup"
+	// defaultCgroupPath is the cgroup docker creates containers under when no cgroup parent is given
+	defaultCgroupPath = "docker"
+	// cgroupUnlimited is the smallest cgroup v1 limit considered as unlimited, v1 reports unlimited as a page aligned max int64
+	cgroupUnlimited = int64(1) << 62
+)
+
+// cgroupMemoryLimit returns the memory limit of the given cgroup and whether it has one,
+// both cgroup v1 (memory.limit_in_bytes) and v2 (memory.max) hierarchies are supported
+func cgroupMemoryLimit(root, path string) (int64, bool, error) {
+	var file string
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		file = filepath.Join(root, path, "memory.max")
+	} else {
+		file = filepath.Join(root, "memory", path, "memory.limit_in_bytes")
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, false, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "max" {
+		return 0, false, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	if limit >= cgroupUnlimited {
+		return 0, false, nil
+	}
+	return limit, true, nil
+}
+
+// effectiveCgroupLimit returns the lowest memory limit of the given cgroup and its ancestors,
+// missing cgroups are skipped since limits are inherited from the closest existing ancestor
+func effectiveCgroupLimit(root, path string) (int64, bool) {
+	var effective int64
+	var found bool
+	for current := filepath.Clean("/" + path); ; current = filepath.Dir(current) {
+		limit, ok, err := cgroupMemoryLimit(root, current)
+		if err == nil && ok && (!found || limit < effective) {
+			effective, found = limit, true
+		}
+		if current == "/" {
+			break
+		}
+	}
+	return effective, found
+}
+
+// cgroupParentPath converts a container cgroup parent to a cgroup path,
+// systemd slices such as "a-b.slice" are nested as "a.slice/a-b.slice"
+func cgroupParentPath(parent string) string {
+	if !strings.HasSuffix(parent, ".slice") || strings.Contains(parent, "/") {
+		return parent
+	}
+	name := strings.TrimSuffix(parent, ".slice")
+	var path, prefix string
+	for _, part := range strings.Split(name, "-") {
+		prefix += part
+		path = filepath.Join(path, prefix+".slice")
+		prefix += "-"
+	}
+	return path
+}
+
+// cgroupRoot returns the configured cgroup mount point
+func (f *basicAuthorizer) cgroupRoot() string {
+	if f.settings.CgroupRoot == "" {
+		return defaultCgroupRoot
+	}
+	return f.settings.CgroupRoot
+}
+
+// cgroupCapacity bounds the given capacity by the effective limit of the cgroup containers run under,
+// and warns when the configured capacities exceed that ceiling
+func (f *basicAuthorizer) cgroupCapacity(capacity, configured containerCost) containerCost {
+	path := f.settings.CgroupPath
+	if path == "" {
+		path = defaultCgroupPath
+	}
+	ceiling, ok := effectiveCgroupLimit(f.cgroupRoot(), path)
+	if !ok {
+		logrus.Infof("No cgroup memory limit found for %q, using host memory as capacity", path)
+		return capacity
+	}
+
+	if configured.Memory > ceiling {
+		logrus.Warnf("Configured memory capacity %s exceeds the cgroup %q limit %s",
+			units.BytesSize(float64(configured.Memory)), path, units.BytesSize(float64(ceiling)))
+	}
+	if configured.Burst > ceiling {
+		logrus.Warnf("Configured burst capacity %s exceeds the cgroup %q limit %s",
+			units.BytesSize(float64(configured.Burst)), path, units.BytesSize(float64(ceiling)))
+	}
+	if configured.Memory == 0 && capacity.Memory > ceiling {
+		capacity.Memory = ceiling
+	}
+	return capacity
+}
+
+// parentEntry builds the ledger entry of a container, registering the limit of its cgroup parent on first use
+func (f *basicAuthorizer) parentEntry(parent string, cost containerCost) ledgerEntry {
+	entry := ledgerEntry{Cost: cost}
+	if !f.settings.CgroupAware || parent == "" {
+		return entry
+	}
+	entry.Parent = parent
+	if limit, ok := effectiveCgroupLimit(f.cgroupRoot(), cgroupParentPath(parent)); ok {
+		f.ledger.setParentCapacity(parent, limit)
+	}
+	return entry
+}
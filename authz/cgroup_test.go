@@ -0,0 +1,48 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectiveCgroupLimit(t *testing.T) {
+
+	tests := []struct {
+		root          string
+		path          string
+		expectedLimit int64
+		expectedFound bool
+	}{
+		{"testdata/cgroup/v1", "docker", 4294967296, true},
+		{"testdata/cgroup/v1", "docker/container", 4294967296, true},
+		{"testdata/cgroup/v1", "tenants", 0, false},
+		{"testdata/cgroup/v1", "tenants/small", 1073741824, true},
+		{"testdata/cgroup/v2", "system.slice/docker.service", 8589934592, true},
+		{"testdata/cgroup/v2", cgroupParentPath("batch-jobs.slice"), 2147483648, true},
+		{"testdata/cgroup/v2", "unlimited", 0, false},
+	}
+
+	for _, test := range tests {
+		limit, found := effectiveCgroupLimit(test.root, test.path)
+		assert.Equal(t, test.expectedFound, found, test.path)
+		assert.Equal(t, test.expectedLimit, limit, test.path)
+	}
+}
+
+func TestCgroupParentBuckets(t *testing.T) {
+
+	f := &basicAuthorizer{
+		settings: &BasicAuthorizerSettings{CgroupAware: true, CgroupRoot: "testdata/cgroup/v1"},
+		ledger:   newLedger(),
+	}
+	f.ledger.setCapacity(containerCost{Memory: 8 * 1024 * 1024 * 1024})
+
+	ok, _ := f.ledger.admit(f.parentEntry("tenants/small", containerCost{Memory: 768 * 1024 * 1024}))
+	assert.True(t, ok)
+	ok, msg := f.ledger.admit(f.parentEntry("tenants/small", containerCost{Memory: 512 * 1024 * 1024}))
+	assert.False(t, ok)
+	assert.Equal(t, "Not enough Memory in cgroup parent tenants/small", msg)
+	ok, _ = f.ledger.admit(f.parentEntry("", containerCost{Memory: 512 * 1024 * 1024}))
+	assert.True(t, ok)
+}
@@ -0,0 +1,212 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AuthzMemory/core"
+	"github.com/docker/engine-api/types/container"
+)
+
+// conditionVariables are the variables of policy rule conditions and the number of fields they accept after their
+// name, -1 for any
+var conditionVariables = map[string]int{
+	"action":  0,
+	"method":  0,
+	"path":    0,
+	"version": 0,
+	"id":      0,
+	"user":    0,
+	"tenant":  0,
+	"image":   0,
+	"body":    -1,
+	"labels":  1,
+	"query":   1,
+	"headers": 1,
+	"params":  1,
+}
+
+// memoryFields are the memory figures of tenant.memory.<field> and host.memory.<field>
+var memoryFields = map[string][]string{
+	"tenant": {"used", "quota"},
+	"host":   {"used", "capacity"},
+}
+
+// conditionEnv resolves the variables of policy rule conditions for a request
+type conditionEnv struct {
+	f          *basicAuthorizer
+	req        *core.RequestContext
+	target     requestTarget
+	hostConfig map[string]interface{} // hostConfig is the host config of container creates as the daemon decodes it
+}
+
+// Validate checks the variable path is known, without request
+func (e conditionEnv) Validate(path []string) error {
+	if fields, ok := memoryFields[path[0]]; ok && len(path) > 1 {
+		if len(path) != 3 || path[1] != "memory" || !contains(fields, path[2]) {
+			return fmt.Errorf("unknown variable %s, expected %s.memory.%s", strings.Join(path, "."), path[0], strings.Join(fields, "|"))
+		}
+		return nil
+	}
+	depth, ok := conditionVariables[path[0]]
+	if !ok {
+		return fmt.Errorf("unknown variable %s", path[0])
+	}
+	if depth >= 0 && len(path)-1 > depth {
+		return fmt.Errorf("unknown variable %s, %s has no field %s", strings.Join(path, "."), path[0], path[1])
+	}
+	return nil
+}
+
+// Lookup returns the value of a variable for the request, nil if it is unset
+func (e conditionEnv) Lookup(path []string) (interface{}, error) {
+	if _, ok := memoryFields[path[0]]; ok && len(path) == 3 && path[1] == "memory" {
+		return e.memory(path[0], path[2]), nil
+	}
+	switch path[0] {
+	case "action":
+		return e.req.Action, nil
+	case "method":
+		return e.req.RequestMethod, nil
+	case "path":
+		return e.req.Path, nil
+	case "version":
+		return e.req.Version, nil
+	case "id":
+		return e.req.ID(), nil
+	case "user":
+		return e.req.User, nil
+	case "tenant":
+		return e.req.Tenant, nil
+	case "image":
+		return e.target.image, nil
+	case "body":
+		value, fields := e.req.Body, path[1:]
+		if e.hostConfig != nil && len(fields) > 0 && strings.EqualFold(fields[0], "HostConfig") {
+			// the daemon reads the host config case insensitively and from the top level without HostConfig
+			value, fields = e.hostConfig, fields[1:]
+		}
+		for _, name := range fields {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+			value = objectField(object, name)
+		}
+		return value, nil
+	case "labels":
+		if len(path) == 1 {
+			return e.target.labels, nil
+		}
+		if value, ok := e.target.labels[path[1]]; ok {
+			return value, nil
+		}
+	case "query":
+		if len(path) == 1 {
+			return firstValues(e.req.Query), nil
+		}
+		if _, ok := e.req.Query[path[1]]; ok {
+			return e.req.Query.Get(path[1]), nil
+		}
+	case "headers":
+		if len(path) == 1 {
+			return firstValues(e.req.Headers), nil
+		}
+		if _, ok := e.req.Headers[http.CanonicalHeaderKey(path[1])]; ok {
+			return e.req.Headers.Get(path[1]), nil
+		}
+	case "params":
+		if len(path) == 1 {
+			return e.req.Params, nil
+		}
+		if value, ok := e.req.Params[path[1]]; ok {
+			return value, nil
+		}
+	}
+	return nil, nil
+}
+
+// normalizedHostConfig returns the host config of a container create as the daemon decodes it, so that
+// body.HostConfig conditions cannot be bypassed by the spelling or placement of the fields, the fields left unset
+// have their zero value (e.g. Memory is 0 for unlimited containers), it returns nil for other requests
+func normalizedHostConfig(req *core.RequestContext) map[string]interface{} {
+	if req.Action != core.ActionContainerCreate || !req.IsJSON() {
+		return nil
+	}
+	hostConfig := make(map[string]interface{})
+	request, err := decodeCreateRequest(req)
+	if err != nil {
+		return hostConfig
+	}
+	if request.HostConfig == nil {
+		request.HostConfig = &container.HostConfig{}
+	}
+	body, err := json.Marshal(request.HostConfig)
+	if err != nil {
+		return hostConfig
+	}
+	if err := json.Unmarshal(body, &hostConfig); err != nil {
+		return make(map[string]interface{})
+	}
+	return hostConfig
+}
+
+// objectField returns the value of an object field the way encoding/json matches struct fields,
+// the exact name first and then a case insensitive match
+func objectField(object map[string]interface{}, name string) interface{} {
+	if value, ok := object[name]; ok {
+		return value
+	}
+	for key, value := range object {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return nil
+}
+
+// memory returns the memory committed to the tenant of the request or to the host, or their quota and capacity,
+// nil for tenants without quota
+func (e conditionEnv) memory(scope, field string) interface{} {
+	if e.f == nil || e.f.ledger == nil {
+		return nil
+	}
+	if scope == "tenant" {
+		used, quota := e.f.ledger.tenantUsage(e.req.Tenant)
+		if field == "used" {
+			return used
+		}
+		if quota == 0 {
+			return nil
+		}
+		return quota
+	}
+	capacity, used := e.f.ledger.snapshot()
+	if field == "used" {
+		return used.Memory
+	}
+	return capacity.Memory
+}
+
+// firstValues returns the first value of every query parameter or header
+func firstValues(values map[string][]string) map[string]string {
+	first := make(map[string]string, len(values))
+	for name, v := range values {
+		if len(v) > 0 {
+			first[name] = v[0]
+		}
+	}
+	return first
+}
+
+// contains returns whether the value is one of the values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package authz
+
+import (
+	"fmt"
+
+	"github.com/AuthzMemory/core"
+	"github.com/docker/engine-api/types/container"
+)
+
+const (
+	// MemoryModelLimit charges containers for their memory limit only
+	MemoryModelLimit = "memory"
+	// MemoryModelSwap charges containers for their memory limit and, separately, for their share of host swap
+	MemoryModelSwap = "memory+swap"
+)
+
+// containerCost describes how much of the host a container may consume
+type containerCost struct {
+	Memory     int64 // Memory is charged against the host memory capacity
+	Swap       int64 // Swap is charged against the host swap capacity
+	Burst      int64 // Burst is charged against the burst capacity when QoS classes are enabled
+	BestEffort int64 // BestEffort is charged against the best effort pool when QoS classes are enabled
+}
+
+// add returns the sum of both costs
+func (c containerCost) add(o containerCost) containerCost {
+	return containerCost{
+		Memory:     c.Memory + o.Memory,
+		Swap:       c.Swap + o.Swap,
+		Burst:      c.Burst + o.Burst,
+		BestEffort: c.BestEffort + o.BestEffort,
+	}
+}
+
+// sub returns the difference of both costs
+func (c containerCost) sub(o containerCost) containerCost {
+	return containerCost{
+		Memory:     c.Memory - o.Memory,
+		Swap:       c.Swap - o.Swap,
+		Burst:      c.Burst - o.Burst,
+		BestEffort: c.BestEffort - o.BestEffort,
+	}
+}
+
+// costOf computes the cost of the given container resources under the configured memory model
+func (f *basicAuthorizer) costOf(res container.Resources) containerCost {
+	var kernel int64
+	if f.settings.CountKernelMemory {
+		kernel = res.KernelMemory
+	}
+	cost := containerCost{Memory: res.Memory + kernel}
+	if f.settings.QoS {
+		cost = f.qosCost(res, kernel)
+	}
+	if f.settings.MemoryModel == MemoryModelSwap {
+		cost.Swap = swapShare(res)
+	}
+	return cost
+}
+
+// entryOf builds the ledger entry of a known container from its resources
+func (f *basicAuthorizer) entryOf(id string, res container.Resources) ledgerEntry {
+	entry := f.parentEntry(res.CgroupParent, f.chargeOf(id, res))
+	entry.Tenant = core.ResourceTenant(id)
+	return entry
+}
+
+// swapShare returns the amount of swap a container may use on top of its memory limit,
+// following the docker semantics of MemorySwap (memory + swap total, -1 for unlimited)
+func swapShare(res container.Resources) int64 {
+	if res.Memory <= 0 || res.MemorySwap < 0 {
+		return 0
+	}
+	if res.MemorySwappiness != nil && *res.MemorySwappiness == 0 {
+		return 0
+	}
+	if res.MemorySwap == 0 {
+		// Docker defaults the swap to the size of the memory limit
+		return res.Memory
+	}
+	if res.MemorySwap > res.Memory {
+		return res.MemorySwap - res.Memory
+	}
+	return 0
+}
+
+// checkResources validates the memory related resources of a container against the configured model,
+// it returns an empty string when the resources are acceptable or the deny reason otherwise
+func (f *basicAuthorizer) checkResources(res container.Resources) string {
+	if res.OomKillDisable != nil && *res.OomKillDisable && res.Memory <= 0 {
+		return "Disabling the OOM killer requires a memory limit (-m)"
+	}
+	if f.settings.MemoryModel == MemoryModelSwap && res.MemorySwap < 0 {
+		return "Unlimited swap (--memory-swap=-1) is not allowed"
+	}
+	if res.MemorySwap > 0 && res.Memory > 0 && res.MemorySwap < res.Memory {
+		return fmt.Sprintf("Memory swap %d must not be smaller than memory %d", res.MemorySwap, res.Memory)
+	}
+	return ""
+}
+
+// validateMemoryModel validates the configured memory model name
+func validateMemoryModel(model string) error {
+	switch model {
+	case MemoryModelLimit, MemoryModelSwap:
+		return nil
+	}
+	return fmt.Errorf("Unknown memory model %q", model)
+}
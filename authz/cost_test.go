@@ -0,0 +1,39 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/docker/engine-api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerCost(t *testing.T) {
+
+	noSwappiness := int64(0)
+	oomKillDisable := true
+
+	tests := []struct {
+		settings     BasicAuthorizerSettings
+		resources    container.Resources
+		expectedCost containerCost
+		expectedMsg  string
+	}{
+		{BasicAuthorizerSettings{MemoryModel: MemoryModelLimit}, container.Resources{Memory: 100, MemorySwap: 300}, containerCost{Memory: 100}, ""},
+		{BasicAuthorizerSettings{MemoryModel: MemoryModelSwap}, container.Resources{Memory: 100, MemorySwap: 300}, containerCost{Memory: 100, Swap: 200}, ""},
+		{BasicAuthorizerSettings{MemoryModel: MemoryModelSwap}, container.Resources{Memory: 100}, containerCost{Memory: 100, Swap: 100}, ""},
+		{BasicAuthorizerSettings{MemoryModel: MemoryModelSwap}, container.Resources{Memory: 100, MemorySwappiness: &noSwappiness}, containerCost{Memory: 100}, ""},
+		{BasicAuthorizerSettings{MemoryModel: MemoryModelSwap}, container.Resources{Memory: 100, MemorySwap: -1}, containerCost{Memory: 100}, "Unlimited swap (--memory-swap=-1) is not allowed"},
+		{BasicAuthorizerSettings{MemoryModel: MemoryModelLimit, CountKernelMemory: true}, container.Resources{Memory: 100, KernelMemory: 50}, containerCost{Memory: 150}, ""},
+		{BasicAuthorizerSettings{MemoryModel: MemoryModelLimit}, container.Resources{OomKillDisable: &oomKillDisable}, containerCost{}, "Disabling the OOM killer requires a memory limit (-m)"},
+		{BasicAuthorizerSettings{MemoryModel: MemoryModelLimit, QoS: true}, container.Resources{Memory: 100, MemoryReservation: 100}, containerCost{Memory: 100, Burst: 100}, ""},
+		{BasicAuthorizerSettings{MemoryModel: MemoryModelLimit, QoS: true}, container.Resources{Memory: 100, MemoryReservation: 40}, containerCost{Memory: 40, Burst: 100}, ""},
+		{BasicAuthorizerSettings{MemoryModel: MemoryModelLimit, QoS: true, BestEffortCharge: 10}, container.Resources{}, containerCost{BestEffort: 10}, ""},
+	}
+
+	for _, test := range tests {
+		settings := test.settings
+		f := &basicAuthorizer{settings: &settings}
+		assert.Equal(t, test.expectedCost, f.costOf(test.resources))
+		assert.Equal(t, test.expectedMsg, f.checkResources(test.resources))
+	}
+}
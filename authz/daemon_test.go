@@ -0,0 +1,77 @@
+package authz
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/docker/engine-api/client"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDaemon is a docker daemon answering the API calls of the tests with canned JSON responses,
+// calls without a response fail with a server error
+type fakeDaemon struct {
+	sync.Mutex
+	server    *httptest.Server
+	responses map[string]string // responses are the JSON bodies by "METHOD /path" without the API version
+	calls     []string          // calls are the "METHOD /path" of the calls received
+	bodies    []string          // bodies are the request bodies of the calls received
+	queries   []string          // queries are the query strings of the calls received
+	client    *client.Client    // client is the docker client calling the fake daemon
+}
+
+// newFakeDaemon starts a fake daemon and creates a docker client calling it
+func newFakeDaemon(t *testing.T, responses map[string]string) *fakeDaemon {
+	d := &fakeDaemon{responses: responses}
+	d.server = httptest.NewServer(http.HandlerFunc(d.serve))
+	var err error
+	d.client, err = client.NewClient("tcp://"+strings.TrimPrefix(d.server.URL, "http://"), "v1.24", nil, nil)
+	assert.NoError(t, err)
+	return d
+}
+
+// serve records the call and writes its canned response
+func (d *fakeDaemon) serve(w http.ResponseWriter, r *http.Request) {
+	call := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/v1.24")
+	body, _ := ioutil.ReadAll(r.Body)
+	d.Lock()
+	d.calls = append(d.calls, call)
+	d.bodies = append(d.bodies, string(body))
+	d.queries = append(d.queries, r.URL.RawQuery)
+	response, ok := d.responses[call]
+	d.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("no response for %s", call), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(response))
+}
+
+// received returns the calls received so far
+func (d *fakeDaemon) received() []string {
+	d.Lock()
+	defer d.Unlock()
+	return append([]string(nil), d.calls...)
+}
+
+// close stops the fake daemon
+func (d *fakeDaemon) close() {
+	d.server.Close()
+}
+
+// connect marks the authorizer as connected to the daemon so that requests do not reach for the docker socket,
+// its docker client calls the fake daemon, if any
+func connect(f *basicAuthorizer, daemon *fakeDaemon) *basicAuthorizer {
+	atomic.StoreInt32(&f.initialized, 1)
+	if daemon != nil {
+		f.cli = daemon.client
+	}
+	return f
+}
@@ -0,0 +1,81 @@
+package authz
+
+import (
+	"github.com/AuthzMemory/core"
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/engine-api/types/container"
+	"golang.org/x/net/context"
+)
+
+// defaultLimit returns the memory limit applied to a limit-less container of the given image and tenant,
+// image rules take precedence over tenant defaults which take precedence over the global default
+func (f *basicAuthorizer) defaultLimit(image, tenant string) (int64, string) {
+	rules := f.imageRules()
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.matches(image) {
+			continue
+		}
+		if rule.Recommended > 0 {
+			return int64(rule.Recommended), "image rule " + rule.Image
+		}
+		if rule.Min > 0 {
+			return int64(rule.Min), "image rule " + rule.Image
+		}
+		break
+	}
+	tenantLimits, defaultLimit := f.settings.TenantDefaultLimits, f.settings.DefaultMemoryLimit
+	if policy := f.policy(); policy != nil {
+		if len(policy.Defaults.TenantMemoryLimits) > 0 {
+			tenantLimits = policy.Defaults.TenantMemoryLimits
+		}
+		if policy.Defaults.MemoryLimit > 0 {
+			defaultLimit = int64(policy.Defaults.MemoryLimit)
+		}
+	}
+	if limit, ok := tenantLimits[tenant]; ok && limit > 0 {
+		return int64(limit), "tenant " + tenant
+	}
+	if defaultLimit > 0 {
+		return defaultLimit, "global default"
+	}
+	return 0, ""
+}
+
+// enforceDefaultLimit applies the default memory limit to a container created without one,
+// authorization plugins cannot alter the create request, so the limit is set once the container exists
+// and before the client gets the chance to start it
+func (f *basicAuthorizer) enforceDefaultLimit(ctx context.Context, authZReq *core.RequestContext, id string) {
+	request, err := decodeCreateRequest(authZReq)
+	if err != nil {
+		return
+	}
+	var resources container.Resources
+	if request.HostConfig != nil {
+		resources = request.HostConfig.Resources
+	}
+	if resources.Memory > 0 {
+		return
+	}
+
+	limit, source := f.defaultLimit(request.Image, authZReq.Tenant)
+	if limit == 0 {
+		return
+	}
+	resources.Memory = limit
+	update := container.UpdateConfig{Resources: container.Resources{Memory: limit}}
+	if _, err := f.cli.ContainerUpdate(ctx, id, update); err != nil {
+		countDockerError(dockerContainerUpdate, err)
+		logrus.Errorf("Failed to apply default memory limit to container %s: %v", id, err)
+		return
+	}
+	if ctx.Err() != nil {
+		// the limit is in place, the next reconcile charges it
+		return
+	}
+	entry := f.parentEntry(resources.CgroupParent, f.costOf(resources))
+	entry.Tenant = authZReq.Tenant
+	f.ledger.commit(id, entry)
+	logrus.Infof("Applied default memory limit of %s from %s to container %s of image %s",
+		MemorySize(limit), source, id, request.Image)
+}
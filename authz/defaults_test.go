@@ -0,0 +1,107 @@
+package authz
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/AuthzMemory/core"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestDefaultLimit(t *testing.T) {
+
+	settings := &BasicAuthorizerSettings{
+		ImageRules: []ImageRule{
+			{Image: "redis", Recommended: 256 << 20},
+			{Image: "nginx", Min: 64 << 20, Max: 1 << 30},
+			{Image: "busybox", Max: 1 << 30},
+		},
+		TenantDefaultLimits: map[string]MemorySize{"team-a": 512 << 20},
+		DefaultMemoryLimit:  1 << 30,
+	}
+	assert.NoError(t, compileImageRules(settings.ImageRules))
+	policy := &Policy{Defaults: PolicyDefaults{
+		MemoryLimit:        2 << 30,
+		TenantMemoryLimits: map[string]MemorySize{"team-b": 128 << 20},
+	}}
+
+	tests := []struct {
+		settings *BasicAuthorizerSettings
+		policy   *Policy
+		image    string
+		tenant   string
+		limit    int64
+		source   string
+	}{
+		{settings, nil, "redis:3", "team-a", 256 << 20, "image rule redis"},
+		{settings, nil, "nginx", "team-a", 64 << 20, "image rule nginx"},
+		{settings, nil, "busybox", "team-a", 512 << 20, "tenant team-a"},
+		{settings, nil, "alpine", "team-b", 1 << 30, "global default"},
+		{settings, nil, "alpine", "", 1 << 30, "global default"},
+		{settings, policy, "redis", "team-b", 256 << 20, "image rule redis"},
+		{settings, policy, "alpine", "team-b", 128 << 20, "tenant team-b"},
+		{settings, policy, "alpine", "team-a", 2 << 30, "global default"},
+		{&BasicAuthorizerSettings{}, nil, "alpine", "team-a", 0, ""},
+	}
+
+	for _, test := range tests {
+		f := &basicAuthorizer{settings: test.settings, ledger: newLedger()}
+		if test.policy != nil {
+			f.applyPolicy(test.policy)
+		}
+		limit, source := f.defaultLimit(test.image, test.tenant)
+		assert.Equal(t, test.limit, limit, "%s %s", test.image, test.tenant)
+		assert.Equal(t, test.source, source, "%s %s", test.image, test.tenant)
+	}
+}
+
+func TestEnforceDefaultLimit(t *testing.T) {
+
+	daemon := newFakeDaemon(t, map[string]string{
+		"POST /containers/updated/update": `{"Warnings":null}`,
+	})
+	defer daemon.close()
+
+	tests := []struct {
+		id     string
+		body   string
+		update bool  // update is whether the container limit is updated
+		charge int64 // charge is the memory committed to the container in the ledger
+	}{
+		{"limited", `{"Image":"alpine","HostConfig":{"Memory":268435456}}`, false, 0},
+		{"updated", `{"Image":"alpine","HostConfig":{}}`, true, 1 << 30},
+		{"updated", `{"Image":"alpine"}`, true, 1 << 30},
+		{"failed", `{"Image":"alpine"}`, true, 0},
+	}
+
+	for _, test := range tests {
+		f := connect(&basicAuthorizer{
+			settings: &BasicAuthorizerSettings{MemoryModel: MemoryModelLimit, DefaultMemoryLimit: 1 << 30},
+			ledger:   newLedger(),
+		}, daemon)
+		calls := len(daemon.received())
+		f.enforceDefaultLimit(context.Background(), core.NewRequestContext(&authorization.Request{
+			RequestMethod:  "POST",
+			RequestURI:     "/v1.24/containers/create",
+			RequestBody:    []byte(test.body),
+			RequestHeaders: map[string]string{core.TenantIDHeaderName: "team-a"},
+		}), test.id)
+
+		received := daemon.received()[calls:]
+		if !test.update {
+			assert.Empty(t, received, test.body)
+			continue
+		}
+		if assert.Len(t, received, 1, test.body) {
+			assert.Equal(t, "POST /containers/"+test.id+"/update", received[0])
+			var update struct{ Memory int64 }
+			assert.NoError(t, json.Unmarshal([]byte(daemon.bodies[len(daemon.bodies)-1]), &update))
+			assert.Equal(t, int64(1<<30), update.Memory)
+		}
+		host, tenants := f.ledger.memoryUsage()
+		assert.Equal(t, test.charge, host.Committed, test.body)
+		assert.Equal(t, test.charge, tenants["team-a"].Committed, test.body)
+	}
+}
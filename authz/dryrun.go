@@ -0,0 +1,157 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AuthzMemory/core"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// EnforcementEnforce denies the requests failing a check
+	EnforcementEnforce = "enforce"
+	// EnforcementAudit only logs and counts the requests that would be denied, and allows them
+	EnforcementAudit = "audit"
+)
+
+// The checks of the basic authorizer, would-be denials are reported by tenant and check,
+// policy rules are reported as policyCheckPrefix followed by the rule name
+const (
+	checkUnknownRoute     = "unknown-route"
+	checkMemoryPressure   = "memory-pressure"
+	checkBodyUnavailable  = "body-unavailable"
+	checkContainerPolicy  = "container-policy"
+	checkMemoryCapacity   = "memory-capacity"
+	checkServiceImageRule = "service-image-rules"
+	policyCheckPrefix     = "policy:"
+)
+
+// validateEnforcementMode returns an error if the enforcement mode is unknown
+func validateEnforcementMode(mode string) error {
+	switch mode {
+	case EnforcementEnforce, EnforcementAudit:
+		return nil
+	}
+	return fmt.Errorf("Unknown enforcement mode %q", mode)
+}
+
+// wouldDenyKey identifies the would-be denials of a tenant by a check
+type wouldDenyKey struct {
+	tenant string
+	check  string
+}
+
+// wouldDenyEntry counts the would-be denials of a tenant by a check
+type wouldDenyEntry struct {
+	Tenant      string    `json:"tenant"`
+	Rule        string    `json:"rule"`
+	Count       int       `json:"count"`
+	LastSeen    time.Time `json:"last_seen"`
+	LastMessage string    `json:"last_message"`
+}
+
+// wouldDenyReport summarises the requests allowed in audit mode that would have been denied
+type wouldDenyReport struct {
+	Mode     string           `json:"mode"`      // Mode is the global enforcement mode
+	Since    time.Time        `json:"since"`     // Since is when the counting started
+	Total    int              `json:"total"`     // Total is the number of would-be denials
+	ByTenant map[string]int   `json:"by_tenant"` // ByTenant counts the would-be denials by tenant
+	ByRule   map[string]int   `json:"by_rule"`   // ByRule counts the would-be denials by check or policy rule
+	Entries  []wouldDenyEntry `json:"entries"`   // Entries count the would-be denials by tenant and rule, most frequent first
+}
+
+// wouldDenials counts the requests allowed in audit mode that would have been denied
+type wouldDenials struct {
+	sync.Mutex
+	since   time.Time
+	entries map[wouldDenyKey]*wouldDenyEntry
+}
+
+// newWouldDenials creates an empty would-be denial counter
+func newWouldDenials() *wouldDenials {
+	return &wouldDenials{since: time.Now(), entries: make(map[wouldDenyKey]*wouldDenyEntry)}
+}
+
+// record logs and counts a would-be denial
+func (w *wouldDenials) record(req *core.RequestContext, check, msg string) {
+	logrus.Warnf("Audit mode: would deny %s %s for tenant %q by %s: %s", req.RequestMethod, req.RequestURI, req.Tenant, check, msg)
+	w.Lock()
+	defer w.Unlock()
+	key := wouldDenyKey{tenant: req.Tenant, check: check}
+	entry, ok := w.entries[key]
+	if !ok {
+		entry = &wouldDenyEntry{Tenant: req.Tenant, Rule: check}
+		w.entries[key] = entry
+	}
+	entry.Count++
+	entry.LastSeen = time.Now()
+	entry.LastMessage = msg
+}
+
+// report summarises the would-be denials
+func (w *wouldDenials) report(mode string) wouldDenyReport {
+	w.Lock()
+	defer w.Unlock()
+	report := wouldDenyReport{
+		Mode:     mode,
+		Since:    w.since,
+		ByTenant: make(map[string]int),
+		ByRule:   make(map[string]int),
+		Entries:  make([]wouldDenyEntry, 0, len(w.entries)),
+	}
+	for _, entry := range w.entries {
+		report.Total += entry.Count
+		report.ByTenant[entry.Tenant] += entry.Count
+		report.ByRule[entry.Rule] += entry.Count
+		report.Entries = append(report.Entries, *entry)
+	}
+	sort.Sort(byCount(report.Entries))
+	return report
+}
+
+// byCount sorts would-be denial entries by decreasing count, then by tenant and rule
+type byCount []wouldDenyEntry
+
+func (s byCount) Len() int      { return len(s) }
+func (s byCount) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCount) Less(i, j int) bool {
+	if s[i].Count != s[j].Count {
+		return s[i].Count > s[j].Count
+	}
+	if s[i].Tenant != s[j].Tenant {
+		return s[i].Tenant < s[j].Tenant
+	}
+	return s[i].Rule < s[j].Rule
+}
+
+// auditOnly returns whether failing checks only log and count would-be denials
+func (f *basicAuthorizer) auditOnly() bool {
+	return f.settings.EnforcementMode == EnforcementAudit
+}
+
+// deny refuses a request failing the given check with the check as reason, and the rule name for policy rules,
+// in audit mode the would-be denial is recorded and the request allowed
+func (f *basicAuthorizer) deny(req *core.RequestContext, check, msg string) core.Decision {
+	if f.auditOnly() {
+		f.wouldDeny.record(req, check, msg)
+		return core.Allow()
+	}
+	decision := core.Deny(check, msg)
+	if strings.HasPrefix(check, policyCheckPrefix) {
+		decision.Rule = strings.TrimPrefix(check, policyCheckPrefix)
+	}
+	return decision
+}
+
+// serveWouldDeny writes the report of the would-be denials
+func (f *basicAuthorizer) serveWouldDeny(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(f.wouldDeny.report(f.settings.EnforcementMode)); err != nil {
+		logrus.Errorf("Failed to write would-be denials: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/AuthzMemory/core"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditMode(t *testing.T) {
+
+	policy := &Policy{Rules: []PolicyRule{
+		{Name: "privileged", Effect: PolicyEffectDeny, Audit: true, When: "body.HostConfig.Privileged"},
+		{Name: "no-latest", Effect: PolicyEffectDeny, Images: []string{"*:latest"}},
+	}}
+	assert.NoError(t, policy.validate())
+
+	request := func(method, uri, tenant, body string) *core.RequestContext {
+		return core.NewRequestContext(&authorization.Request{
+			RequestMethod:  method,
+			RequestURI:     uri,
+			RequestBody:    []byte(body),
+			RequestHeaders: map[string]string{core.TenantIDHeaderName: tenant},
+		})
+	}
+
+	tests := []struct {
+		mode    string
+		method  string
+		uri     string
+		tenant  string
+		body    string
+		allowed bool
+	}{
+		{EnforcementEnforce, "POST", "/v1.24/containers/create", "team-a", `{"Image":"busybox:1","HostConfig":{"Privileged":true,"Memory":268435456}}`, true},
+		{EnforcementEnforce, "POST", "/v1.24/containers/create", "team-a", `{"Image":"busybox:latest","HostConfig":{"Memory":536870912}}`, false},
+		{EnforcementEnforce, "POST", "/v1.24/containers/create", "team-a", `{"Image":"busybox:1","HostConfig":{"Memory":2147483648}}`, false},
+		{EnforcementAudit, "POST", "/v1.24/containers/create", "team-a", `{"Image":"busybox:latest","HostConfig":{"Memory":268435456}}`, true},
+		{EnforcementAudit, "POST", "/v1.24/containers/create", "team-b", `{"Image":"busybox:1","HostConfig":{"Memory":2147483648}}`, true},
+		{EnforcementAudit, "GET", "/v1.25/secrets", "team-b", ``, true},
+	}
+
+	f := connect(&basicAuthorizer{
+		settings:  &BasicAuthorizerSettings{MemoryModel: MemoryModelLimit, UnknownRoutePolicy: UnknownRouteDeny},
+		unmatched: newUnmatchedRoutes(),
+		wouldDeny: newWouldDenials(),
+		ledger:    newLedger(),
+	}, nil)
+	f.applyPolicy(policy)
+	f.ledger.setCapacity(containerCost{Memory: 1 << 30})
+
+	for _, test := range tests {
+		f.settings.EnforcementMode = test.mode
+		res := f.AuthZReq(request(test.method, test.uri, test.tenant, test.body))
+		assert.Equal(t, test.allowed, res.Allow, "%s %s %s", test.mode, test.uri, test.body)
+	}
+
+	_, used := f.ledger.snapshot()
+	assert.Equal(t, int64(256<<20+256<<20+2<<30), used.Memory, "containers admitted in audit mode are charged")
+
+	report := f.wouldDeny.report(EnforcementAudit)
+	assert.Equal(t, 4, report.Total)
+	assert.Equal(t, map[string]int{"team-a": 2, "team-b": 2}, report.ByTenant)
+	assert.Equal(t, map[string]int{
+		policyCheckPrefix + "privileged": 1,
+		policyCheckPrefix + "no-latest":  1,
+		checkMemoryCapacity:              1,
+		checkUnknownRoute:                1,
+	}, report.ByRule)
+	assert.Equal(t, policyCheckPrefix+"no-latest", report.Entries[0].Rule)
+	assert.Equal(t, `Request denied by policy rule "no-latest"`, report.Entries[0].LastMessage)
+
+	assert.EqualError(t, validateEnforcementMode("dry"), `Unknown enforcement mode "dry"`)
+}
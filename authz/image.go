@@ -0,0 +1,161 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+)
+
+// defaultTag is the tag docker resolves untagged image references to
+const defaultTag = "latest"
+
+// imageKey normalizes an image reference so that "busybox" and "busybox:latest" are tracked together,
+// references that fail to parse (e.g. image ids) are returned unchanged
+func imageKey(image string) string {
+	named, err := reference.ParseNamed(image)
+	if err != nil {
+		return image
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		return named.Name() + "@" + canonical.Digest().String()
+	}
+	if tagged, ok := named.(reference.NamedTagged); ok {
+		return named.Name() + ":" + tagged.Tag()
+	}
+	return named.Name() + ":" + defaultTag
+}
+
+// ImageRule sets memory limits for the images matching a reference pattern,
+// the pattern is a repository optionally followed by a tag or a digest, where the repository and tag may use
+// shell globs (e.g. "elasticsearch", "myorg/*:1.*", "busybox@sha256:...")
+type ImageRule struct {
+	Image       string     `json:"image"`                 // Image is the reference pattern the rule applies to
+	Min         MemorySize `json:"min,omitempty"`         // Min is the minimal memory limit containers of the image must request
+	Max         MemorySize `json:"max,omitempty"`         // Max is the maximal memory limit containers of the image may request
+	Recommended MemorySize `json:"recommended,omitempty"` // Recommended is the memory limit suggested in deny messages
+
+	name   string // name is the repository pattern
+	tag    string // tag is the tag pattern, empty to match any tag
+	digest string // digest is the digest to match, empty to match any digest
+}
+
+// compile splits and validates the reference pattern of the rule
+func (r *ImageRule) compile() error {
+	pattern := r.Image
+	if i := strings.Index(pattern, "@"); i >= 0 {
+		pattern, r.digest = pattern[:i], pattern[i+1:]
+	} else if i := strings.LastIndex(pattern, ":"); i > strings.LastIndex(pattern, "/") {
+		pattern, r.tag = pattern[:i], pattern[i+1:]
+	}
+	r.name = pattern
+
+	if _, err := path.Match(r.name, ""); err != nil {
+		return fmt.Errorf("Invalid image rule %q: %v", r.Image, err)
+	}
+	if _, err := path.Match(r.tag, ""); err != nil {
+		return fmt.Errorf("Invalid image rule %q: %v", r.Image, err)
+	}
+	if !strings.ContainsAny(r.Image, "*?[") {
+		if _, err := reference.Parse(r.Image); err != nil {
+			return fmt.Errorf("Invalid image rule %q: %v", r.Image, err)
+		}
+	}
+	if r.Min > 0 && r.Max > 0 && r.Min > r.Max {
+		return fmt.Errorf("Invalid image rule %q: min %s is larger than max %s", r.Image, r.Min, r.Max)
+	}
+	return nil
+}
+
+// matches returns whether the given image reference matches the rule pattern
+func (r *ImageRule) matches(image string) bool {
+	named, err := reference.ParseNamed(image)
+	if err != nil {
+		return false
+	}
+	if ok, _ := path.Match(r.name, named.Name()); !ok {
+		return false
+	}
+	if r.digest != "" {
+		canonical, ok := named.(reference.Canonical)
+		return ok && canonical.Digest().String() == r.digest
+	}
+	if r.tag != "" {
+		tag := defaultTag
+		if tagged, ok := named.(reference.NamedTagged); ok {
+			tag = tagged.Tag()
+		} else if _, ok := named.(reference.Canonical); ok {
+			return false
+		}
+		ok, _ := path.Match(r.tag, tag)
+		return ok
+	}
+	return true
+}
+
+// check validates a memory limit against the rule, returning the deny reason or an empty string
+func (r *ImageRule) check(image string, memory int64) string {
+	suggestion := r.Recommended
+	if suggestion == 0 {
+		suggestion = r.Min
+	}
+	if r.Min > 0 && (memory == 0 || memory < int64(r.Min)) {
+		return fmt.Sprintf("Image %s requires a memory limit of at least %s (rule %q), use -m %s", image, r.Min, r.Image, suggestion)
+	}
+	if r.Max > 0 && (memory == 0 || memory > int64(r.Max)) {
+		if suggestion == 0 {
+			suggestion = r.Max
+		}
+		return fmt.Sprintf("Image %s allows a memory limit of at most %s (rule %q), use -m %s", image, r.Max, r.Image, suggestion)
+	}
+	return ""
+}
+
+// LoadImageRules reads and validates a JSON list of image rules
+func LoadImageRules(file string) ([]ImageRule, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []ImageRule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("Failed to parse image rules %s: %v", file, err)
+	}
+	return rules, compileImageRules(rules)
+}
+
+// compileImageRules validates every image rule
+func compileImageRules(rules []ImageRule) error {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageRules returns the image rules of the policy, falling back to the settings
+func (f *basicAuthorizer) imageRules() []ImageRule {
+	if policy := f.policy(); policy != nil && len(policy.Images) > 0 {
+		return policy.Images
+	}
+	return f.settings.ImageRules
+}
+
+// checkImageRules validates a memory limit against the first image rule matching the image
+func (f *basicAuthorizer) checkImageRules(image string, memory int64) string {
+	if image == "" {
+		return ""
+	}
+	rules := f.imageRules()
+	for i := range rules {
+		rule := &rules[i]
+		if rule.matches(image) {
+			return rule.check(image, memory)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageRules(t *testing.T) {
+
+	f := &basicAuthorizer{settings: &BasicAuthorizerSettings{ImageRules: []ImageRule{
+		{Image: "busybox@sha256:e0b3d4a7a4c2b0b1f0b4b3d3d0b2e2c1e2e4b2d4c0a3e1b2c3d4e5f6a7b8c9d0", Max: 64 << 20},
+		{Image: "elasticsearch:2.*", Min: 2 << 30},
+		{Image: "elasticsearch", Min: 1 << 30, Recommended: 2 << 30},
+		{Image: "myorg/*", Max: 256 << 20},
+	}}}
+	assert.NoError(t, compileImageRules(f.settings.ImageRules))
+
+	tests := []struct {
+		image       string
+		memory      int64
+		expectedMsg string
+	}{
+		{"elasticsearch", 0, `Image elasticsearch requires a memory limit of at least 1 GiB (rule "elasticsearch"), use -m 2 GiB`},
+		{"elasticsearch:5.0", 512 << 20, `Image elasticsearch:5.0 requires a memory limit of at least 1 GiB (rule "elasticsearch"), use -m 2 GiB`},
+		{"elasticsearch:5.0", 1 << 30, ""},
+		{"elasticsearch:2.4", 1 << 30, `Image elasticsearch:2.4 requires a memory limit of at least 2 GiB (rule "elasticsearch:2.*"), use -m 2 GiB`},
+		{"myorg/api:1.0", 512 << 20, `Image myorg/api:1.0 allows a memory limit of at most 256 MiB (rule "myorg/*"), use -m 256 MiB`},
+		{"myorg/api:1.0", 128 << 20, ""},
+		{"myorg/team/api", 0, ""},
+		{"busybox@sha256:e0b3d4a7a4c2b0b1f0b4b3d3d0b2e2c1e2e4b2d4c0a3e1b2c3d4e5f6a7b8c9d0", 0, `Image busybox@sha256:e0b3d4a7a4c2b0b1f0b4b3d3d0b2e2c1e2e4b2d4c0a3e1b2c3d4e5f6a7b8c9d0 allows a memory limit of at most 64 MiB (rule "busybox@sha256:e0b3d4a7a4c2b0b1f0b4b3d3d0b2e2c1e2e4b2d4c0a3e1b2c3d4e5f6a7b8c9d0"), use -m 64 MiB`},
+		{"busybox", 0, ""},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expectedMsg, f.checkImageRules(test.image, test.memory), test.image)
+	}
+
+	assert.Error(t, compileImageRules([]ImageRule{{Image: "UPPER"}}))
+	assert.Error(t, compileImageRules([]ImageRule{{Image: "a", Min: 2, Max: 1}}))
+}
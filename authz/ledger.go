@@ -0,0 +1,231 @@
+package authz
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ledgerEntry is the cost charged for a single container
+type ledgerEntry struct {
+	Cost   containerCost // Cost is the cost of the container
+	Parent string        // Parent is the cgroup parent the container runs under, empty for the default one
+	Tenant string        // Tenant is the tenant owning the container, empty if unknown
+}
+
+// memoryUsage is the memory committed to created containers and admitted to containers not created yet
+type memoryUsage struct {
+	Committed int64 // Committed is the memory of the containers known by id
+	Pending   int64 // Pending is the memory admitted to containers whose creation was not seen yet
+}
+
+// ledger keeps track of the memory committed to containers on the host
+type ledger struct {
+	sync.Mutex
+	capacity       containerCost          // capacity is the memory and swap available for containers
+	used           containerCost          // used is the cost committed to admitted containers
+	perID          map[string]ledgerEntry // perID is the cost of every known container
+	parentCapacity map[string]int64       // parentCapacity is the memory limit of every limited cgroup parent
+	parentUsed     map[string]int64       // parentUsed is the memory committed under every cgroup parent
+	tenantQuota    map[string]int64       // tenantQuota is the memory quota of every tenant with one
+	tenantUsed     map[string]int64       // tenantUsed is the memory committed to the containers of every tenant
+}
+
+// newLedger creates an empty ledger
+func newLedger() *ledger {
+	return &ledger{
+		perID:          make(map[string]ledgerEntry),
+		parentCapacity: make(map[string]int64),
+		parentUsed:     make(map[string]int64),
+		tenantQuota:    make(map[string]int64),
+		tenantUsed:     make(map[string]int64),
+	}
+}
+
+// setCapacity sets the memory and swap available for containers
+func (l *ledger) setCapacity(capacity containerCost) {
+	l.Lock()
+	defer l.Unlock()
+	l.capacity = capacity
+}
+
+// setParentCapacity sets the memory available for containers under the given cgroup parent
+func (l *ledger) setParentCapacity(parent string, capacity int64) {
+	l.Lock()
+	defer l.Unlock()
+	l.parentCapacity[parent] = capacity
+}
+
+// setTenantQuotas replaces the memory quotas of the tenants
+func (l *ledger) setTenantQuotas(quotas map[string]int64) {
+	l.Lock()
+	defer l.Unlock()
+	l.tenantQuota = quotas
+}
+
+// admit commits the given cost if it fits in the remaining capacity, and returns whether it did
+func (l *ledger) admit(entry ledgerEntry) (bool, string) {
+	l.Lock()
+	defer l.Unlock()
+	cost := entry.Cost
+	if cost.BestEffort == 0 && l.used.Memory+cost.Memory >= l.capacity.Memory {
+		return false, "Not enough Memory"
+	}
+	if cost.Burst > 0 && l.used.Burst+cost.Burst > l.capacity.Burst {
+		return false, "Not enough burst capacity"
+	}
+	if cost.BestEffort > 0 && l.used.BestEffort+cost.BestEffort > l.capacity.BestEffort {
+		return false, "Best effort pool exhausted"
+	}
+	// A host without swap cannot be pushed into swapping, so swap is only charged when there is some
+	if l.capacity.Swap > 0 && cost.Swap > 0 && l.used.Swap+cost.Swap > l.capacity.Swap {
+		return false, "Not enough Swap"
+	}
+	if limit, ok := l.parentCapacity[entry.Parent]; ok && entry.Parent != "" && l.parentUsed[entry.Parent]+cost.Memory > limit {
+		return false, fmt.Sprintf("Not enough Memory in cgroup parent %s", entry.Parent)
+	}
+	if quota, ok := l.tenantQuota[entry.Tenant]; ok && entry.Tenant != "" && l.tenantUsed[entry.Tenant]+cost.Memory > quota {
+		return false, fmt.Sprintf("Tenant %s memory quota of %s exceeded", entry.Tenant, MemorySize(quota))
+	}
+	l.used = l.used.add(cost)
+	l.parentUsed[entry.Parent] += cost.Memory
+	l.tenantUsed[entry.Tenant] += cost.Memory
+	return true, ""
+}
+
+// charge commits the given cost without checking the capacity, it is used for containers created
+// in audit mode despite not fitting
+func (l *ledger) charge(entry ledgerEntry) {
+	l.Lock()
+	defer l.Unlock()
+	l.used = l.used.add(entry.Cost)
+	l.parentUsed[entry.Parent] += entry.Cost.Memory
+	l.tenantUsed[entry.Tenant] += entry.Cost.Memory
+}
+
+// refund frees the cost of an admission whose container will not be created
+func (l *ledger) refund(entry ledgerEntry) {
+	l.Lock()
+	defer l.Unlock()
+	l.used = l.used.sub(entry.Cost)
+	l.parentUsed[entry.Parent] -= entry.Cost.Memory
+	l.tenantUsed[entry.Tenant] -= entry.Cost.Memory
+}
+
+// record associates the cost of a created container with its id, its admission already charged the cost.
+// An entry committed before the create event was handled is replaced and the totals adjusted as commit does
+func (l *ledger) record(id string, entry ledgerEntry) {
+	l.Lock()
+	defer l.Unlock()
+	if previous, ok := l.perID[id]; ok {
+		l.replace(previous, entry)
+	}
+	l.perID[id] = entry
+}
+
+// commit replaces the cost of a known container without checking the capacity,
+// it is used when the cost of a container is raised after its admission
+func (l *ledger) commit(id string, entry ledgerEntry) {
+	l.Lock()
+	defer l.Unlock()
+	l.replace(l.perID[id], entry)
+	l.perID[id] = entry
+}
+
+// replace moves the totals from the previous cost of a container to the new one, the lock must be held
+func (l *ledger) replace(previous, entry ledgerEntry) {
+	l.used = l.used.sub(previous.Cost).add(entry.Cost)
+	l.parentUsed[previous.Parent] -= previous.Cost.Memory
+	l.parentUsed[entry.Parent] += entry.Cost.Memory
+	l.tenantUsed[previous.Tenant] -= previous.Cost.Memory
+	l.tenantUsed[entry.Tenant] += entry.Cost.Memory
+}
+
+// assignTenant records the tenant of a known container whose entry was recorded before its owner was known
+func (l *ledger) assignTenant(id, tenant string) {
+	l.Lock()
+	defer l.Unlock()
+	if entry, ok := l.perID[id]; ok && entry.Tenant == "" {
+		entry.Tenant = tenant
+		l.perID[id] = entry
+	}
+}
+
+// release frees the cost of a destroyed container
+func (l *ledger) release(id string) {
+	l.Lock()
+	defer l.Unlock()
+	entry := l.perID[id]
+	l.used = l.used.sub(entry.Cost)
+	l.parentUsed[entry.Parent] -= entry.Cost.Memory
+	l.tenantUsed[entry.Tenant] -= entry.Cost.Memory
+	delete(l.perID, id)
+}
+
+// reset replaces the committed cost with the one computed from the running containers
+func (l *ledger) reset(entries map[string]ledgerEntry) {
+	l.Lock()
+	defer l.Unlock()
+	l.perID = entries
+	l.used = containerCost{}
+	l.parentUsed = make(map[string]int64)
+	l.tenantUsed = make(map[string]int64)
+	for _, entry := range entries {
+		l.used = l.used.add(entry.Cost)
+		l.parentUsed[entry.Parent] += entry.Cost.Memory
+		l.tenantUsed[entry.Tenant] += entry.Cost.Memory
+	}
+}
+
+// snapshot returns the current capacity and committed cost
+func (l *ledger) snapshot() (capacity, used containerCost) {
+	l.Lock()
+	defer l.Unlock()
+	return l.capacity, l.used
+}
+
+// tenantUsage returns the memory committed to the containers of a tenant and its quota, zero if it has none
+func (l *ledger) tenantUsage(tenant string) (used, quota int64) {
+	l.Lock()
+	defer l.Unlock()
+	return l.tenantUsed[tenant], l.tenantQuota[tenant]
+}
+
+// memoryUsage returns the committed and pending memory of the host and of every tenant
+func (l *ledger) memoryUsage() (memoryUsage, map[string]memoryUsage) {
+	l.Lock()
+	defer l.Unlock()
+	var host memoryUsage
+	tenants := make(map[string]memoryUsage)
+	for _, entry := range l.perID {
+		host.Committed += entry.Cost.Memory
+		usage := tenants[entry.Tenant]
+		usage.Committed += entry.Cost.Memory
+		tenants[entry.Tenant] = usage
+	}
+	host.Pending = pendingMemory(l.used.Memory, host.Committed)
+	for tenant, used := range l.tenantUsed {
+		usage := tenants[tenant]
+		usage.Pending = pendingMemory(used, usage.Committed)
+		tenants[tenant] = usage
+	}
+	return host, tenants
+}
+
+// pendingMemory returns the part of the used memory not committed to known containers
+func pendingMemory(used, committed int64) int64 {
+	if used < committed {
+		return 0
+	}
+	return used - committed
+}
+
+// quotas returns the memory quotas of the tenants with one
+func (l *ledger) quotas() map[string]int64 {
+	l.Lock()
+	defer l.Unlock()
+	quotas := make(map[string]int64, len(l.tenantQuota))
+	for tenant, quota := range l.tenantQuota {
+		quotas[tenant] = quota
+	}
+	return quotas
+}
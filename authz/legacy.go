@@ -0,0 +1,85 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/AuthzMemory/core"
+	"github.com/docker/engine-api/types/container"
+)
+
+// legacyField is a host config field older API versions carried at the top level of container create bodies
+type legacyField struct {
+	name  string                                     // name is the JSON name of the field at the top level
+	field func(hc *container.HostConfig) interface{} // field returns a pointer to the matching host config field
+}
+
+// legacyFields are the fields that moved under HostConfig, the daemon still reads them from the top level
+// for every API version when HostConfig leaves them unset, every other resource field (e.g. KernelMemory,
+// MemoryReservation) was introduced under HostConfig
+var legacyFields = []legacyField{
+	{name: "Memory", field: func(hc *container.HostConfig) interface{} { return &hc.Memory }},
+	{name: "MemorySwap", field: func(hc *container.HostConfig) interface{} { return &hc.MemorySwap }},
+	{name: "CpuShares", field: func(hc *container.HostConfig) interface{} { return &hc.CPUShares }},
+	{name: "Cpuset", field: func(hc *container.HostConfig) interface{} { return &hc.CpusetCpus }},
+	{name: "VolumeDriver", field: func(hc *container.HostConfig) interface{} { return &hc.VolumeDriver }},
+}
+
+// decodeCreateRequest decodes a container create body the way the daemon does: without HostConfig the whole host
+// config is read from the top level (e.g. Memory, Privileged, OomKillDisable), with HostConfig the top level legacy
+// fields only apply when HostConfig leaves them unset
+func decodeCreateRequest(authZReq *core.RequestContext) (createRequest, error) {
+	var request createRequest
+	if err := json.Unmarshal(authZReq.RequestBody, &request); err != nil {
+		return request, err
+	}
+
+	if request.HostConfig == nil {
+		var hostConfig container.HostConfig
+		if err := json.Unmarshal(authZReq.RequestBody, &hostConfig); err != nil {
+			return request, err
+		}
+		if !reflect.DeepEqual(hostConfig, container.HostConfig{}) {
+			request.HostConfig = &hostConfig
+		}
+	}
+
+	var topLevel map[string]json.RawMessage
+	if err := json.Unmarshal(authZReq.RequestBody, &topLevel); err != nil {
+		return request, err
+	}
+	for _, legacy := range legacyFields {
+		raw, ok := jsonField(topLevel, legacy.name)
+		if !ok {
+			continue
+		}
+		if request.HostConfig == nil {
+			request.HostConfig = &container.HostConfig{}
+		}
+		field := legacy.field(request.HostConfig)
+		value := reflect.ValueOf(field).Elem()
+		if value.Interface() != reflect.Zero(value.Type()).Interface() {
+			continue
+		}
+		if err := json.Unmarshal(raw, field); err != nil {
+			return request, fmt.Errorf("Invalid %s in container create request: %v", legacy.name, err)
+		}
+	}
+	return request, nil
+}
+
+// jsonField returns the value of an object field the way encoding/json matches struct fields,
+// the exact name first and then a case insensitive match
+func jsonField(fields map[string]json.RawMessage, name string) (json.RawMessage, bool) {
+	if raw, ok := fields[name]; ok {
+		return raw, true
+	}
+	for key, raw := range fields {
+		if strings.EqualFold(key, name) {
+			return raw, true
+		}
+	}
+	return nil, false
+}
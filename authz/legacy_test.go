@@ -0,0 +1,112 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/AuthzMemory/core"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeCreateRequest(t *testing.T) {
+
+	legacy := `{"Image":"busybox","Memory":268435456,"MemorySwap":536870912,"CpuShares":512,"Cpuset":"0,1"}`
+	both := `{"Image":"busybox","Memory":268435456,"MemorySwap":-1,"HostConfig":{"Memory":134217728}}`
+	lowerCase := `{"Image":"busybox","memory":268435456}`
+	current := `{"Image":"busybox","HostConfig":{"Memory":134217728,"MemorySwap":268435456,"KernelMemory":4194304}}`
+
+	tests := []struct {
+		url        string
+		body       string
+		memory     int64
+		memorySwap int64
+	}{
+		{"/v1.12/containers/create", legacy, 268435456, 536870912},
+		{"/v1.13/containers/create", legacy, 268435456, 536870912},
+		{"/v1.14/containers/create", legacy, 268435456, 536870912},
+		{"/v1.15/containers/create", legacy, 268435456, 536870912},
+		{"/v1.16/containers/create", legacy, 268435456, 536870912},
+		{"/v1.17/containers/create", legacy, 268435456, 536870912},
+		{"/v1.18/containers/create", legacy, 268435456, 536870912},
+		{"/v.1.18/containers/create", legacy, 268435456, 536870912},
+		{"/v1.18/containers/create", both, 134217728, -1},
+		{"/v1.18/containers/create", current, 134217728, 268435456},
+		{"/v1.19/containers/create", legacy, 268435456, 536870912},
+		{"/v1.19/containers/create", both, 134217728, -1},
+		{"/v1.19/containers/create", current, 134217728, 268435456},
+		{"/v1.20/containers/create", current, 134217728, 268435456},
+		{"/v1.21/containers/create", current, 134217728, 268435456},
+		{"/v.1.21/containers/create", current, 134217728, 268435456},
+		{"/v1.22/containers/create", current, 134217728, 268435456},
+		{"/v1.23/containers/create", current, 134217728, 268435456},
+		{"/v1.24/containers/create", current, 134217728, 268435456},
+		{"/v1.25/containers/create", current, 134217728, 268435456},
+		{"/v1.25/containers/create", legacy, 268435456, 536870912},
+		{"/v1.25/containers/create", both, 134217728, -1},
+		{"/v1.25/containers/create", lowerCase, 268435456, 0},
+		{"/containers/create", legacy, 268435456, 536870912},
+	}
+
+	for _, test := range tests {
+		request, err := decodeCreateRequest(core.NewRequestContext(&authorization.Request{RequestURI: test.url, RequestBody: []byte(test.body)}))
+		assert.NoError(t, err, test.url)
+		assert.Equal(t, "busybox", request.Image, test.url)
+		var memory, memorySwap int64
+		if request.HostConfig != nil {
+			memory, memorySwap = request.HostConfig.Memory, request.HostConfig.MemorySwap
+		}
+		assert.Equal(t, test.memory, memory, "%s %s", test.url, test.body)
+		assert.Equal(t, test.memorySwap, memorySwap, "%s %s", test.url, test.body)
+	}
+
+	request, err := decodeCreateRequest(core.NewRequestContext(&authorization.Request{RequestURI: "/v1.15/containers/create", RequestBody: []byte(legacy)}))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(512), request.HostConfig.CPUShares)
+	assert.Equal(t, "0,1", request.HostConfig.CpusetCpus)
+
+	request, err = decodeCreateRequest(core.NewRequestContext(&authorization.Request{RequestURI: "/v1.25/containers/create",
+		RequestBody: []byte(`{"Image":"busybox","VolumeDriver":"convoy","HostConfig":{"Memory":134217728}}`)}))
+	assert.NoError(t, err)
+	assert.Equal(t, "convoy", request.HostConfig.VolumeDriver)
+	assert.Equal(t, int64(134217728), request.HostConfig.Memory)
+
+	// without HostConfig the daemon reads the whole host config from the top level
+	request, err = decodeCreateRequest(core.NewRequestContext(&authorization.Request{RequestURI: "/v1.25/containers/create",
+		RequestBody: []byte(`{"Image":"busybox","Privileged":true,"OomKillDisable":true}`)}))
+	assert.NoError(t, err)
+	if assert.NotNil(t, request.HostConfig) {
+		assert.True(t, request.HostConfig.Privileged)
+		assert.True(t, *request.HostConfig.OomKillDisable)
+	}
+	request, err = decodeCreateRequest(core.NewRequestContext(&authorization.Request{RequestURI: "/v1.25/containers/create",
+		RequestBody: []byte(`{"Image":"busybox","Privileged":true,"HostConfig":{}}`)}))
+	assert.NoError(t, err)
+	assert.False(t, request.HostConfig.Privileged)
+	request, err = decodeCreateRequest(core.NewRequestContext(&authorization.Request{RequestURI: "/v1.25/containers/create",
+		RequestBody: []byte(`{"Image":"busybox"}`)}))
+	assert.NoError(t, err)
+	assert.Nil(t, request.HostConfig)
+
+	_, err = decodeCreateRequest(core.NewRequestContext(&authorization.Request{RequestURI: "/v1.15/containers/create", RequestBody: []byte(`{"Memory":"256m"}`)}))
+	assert.Error(t, err)
+}
+
+func TestLegacyFieldsCharged(t *testing.T) {
+
+	// the top level Memory of any API version is charged, as the daemon applies it
+	for _, uri := range []string{"/v1.18/containers/create", "/v1.25/containers/create", "/containers/create"} {
+		f := connect(&basicAuthorizer{
+			settings:  &BasicAuthorizerSettings{MemoryModel: MemoryModelLimit, UnknownRoutePolicy: UnknownRouteDeny, EnforcementMode: EnforcementEnforce},
+			unmatched: newUnmatchedRoutes(),
+			wouldDeny: newWouldDenials(),
+			ledger:    newLedger(),
+		}, nil)
+		f.ledger.setCapacity(containerCost{Memory: 1 << 30})
+		res := f.AuthZReq(core.NewRequestContext(&authorization.Request{
+			RequestMethod: "POST",
+			RequestURI:    uri,
+			RequestBody:   []byte(`{"Image":"busybox","Memory":2147483648}`),
+		}))
+		assert.False(t, res.Allow, uri)
+	}
+}
@@ -0,0 +1,39 @@
+package authz
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultMeminfoPath is the kernel memory statistics file
+const defaultMeminfoPath = "/proc/meminfo"
+
+// readMeminfo parses a meminfo formatted file and returns every field in bytes
+func readMeminfo(path string) (map[string]int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fields := make(map[string]int64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Lines look like "MemAvailable:    1234567 kB"
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(parts) > 2 && parts[2] == "kB" {
+			value *= 1024
+		}
+		fields[strings.TrimSuffix(parts[0], ":")] = value
+	}
+	return fields, scanner.Err()
+}
@@ -0,0 +1,110 @@
+package authz
+
+import (
+	"sync"
+
+	"github.com/AuthzMemory/metrics"
+)
+
+const (
+	// dockerInfo and the other docker operations label the docker API error counts
+	dockerInfo             = "info"
+	dockerEvents           = "events"
+	dockerContainerList    = "container_list"
+	dockerContainerInspect = "container_inspect"
+	dockerContainerStats   = "container_stats"
+	dockerContainerUpdate  = "container_update"
+	dockerContainerPause   = "container_pause"
+	dockerContainerStop    = "container_stop"
+	dockerContainerRemove  = "container_remove"
+)
+
+var (
+	// eventStreamReconnects counts the reconnections to the docker event stream
+	eventStreamReconnects = metrics.NewCounter("authz_broker_event_stream_reconnects_total",
+		"Reconnections to the docker event stream after it ended or failed.")
+	// reconciles counts the reconciliations of the ledger with the containers reported by the daemon
+	reconciles = metrics.NewCounter("authz_broker_reconciles_total",
+		"Reconciliations of the memory ledger with the containers listed by the daemon.")
+	// reconcileDrift is the memory the ledger was off by at the last reconciliation
+	reconcileDrift = metrics.NewGauge("authz_broker_reconcile_drift_bytes",
+		"Memory committed in the ledger minus the memory of the listed containers at the last reconciliation.")
+	// dockerAPIErrors counts the failed docker API calls by operation
+	dockerAPIErrors = metrics.NewCounter("authz_broker_docker_api_errors_total",
+		"Failed docker API calls by operation.", "operation")
+)
+
+// meteredLedger is the ledger reported by the memory gauges, the one of the basic authorizer which the broker
+// configures at most once
+var meteredLedger struct {
+	sync.Mutex
+	ledger *ledger
+}
+
+func init() {
+	ledgerGauge("authz_broker_memory_capacity_bytes", "Memory available for containers on the host.",
+		func(l *ledger, emit func(float64, ...string)) {
+			capacity, _ := l.snapshot()
+			emit(float64(capacity.Memory))
+		})
+	ledgerGauge("authz_broker_memory_committed_bytes", "Memory committed to the containers created on the host.",
+		func(l *ledger, emit func(float64, ...string)) {
+			host, _ := l.memoryUsage()
+			emit(float64(host.Committed))
+		})
+	ledgerGauge("authz_broker_memory_pending_bytes", "Memory admitted on the host to containers not created yet.",
+		func(l *ledger, emit func(float64, ...string)) {
+			host, _ := l.memoryUsage()
+			emit(float64(host.Pending))
+		})
+	ledgerGauge("authz_broker_tenant_memory_committed_bytes", "Memory committed to the containers created by tenant.",
+		func(l *ledger, emit func(float64, ...string)) {
+			_, tenants := l.memoryUsage()
+			for tenant, usage := range tenants {
+				emit(float64(usage.Committed), tenant)
+			}
+		}, "tenant")
+	ledgerGauge("authz_broker_tenant_memory_pending_bytes", "Memory admitted to containers not created yet by tenant.",
+		func(l *ledger, emit func(float64, ...string)) {
+			_, tenants := l.memoryUsage()
+			for tenant, usage := range tenants {
+				emit(float64(usage.Pending), tenant)
+			}
+		}, "tenant")
+	ledgerGauge("authz_broker_tenant_memory_quota_bytes", "Memory quota by tenant, for the tenants with one.",
+		func(l *ledger, emit func(float64, ...string)) {
+			for tenant, quota := range l.quotas() {
+				emit(float64(quota), tenant)
+			}
+		}, "tenant")
+}
+
+// ledgerGauge registers a gauge collected from the metered ledger, it has no series before initialization
+func ledgerGauge(name, help string, collect func(l *ledger, emit func(float64, ...string)), labels ...string) {
+	metrics.NewGaugeFunc(name, help, func(emit func(float64, ...string)) {
+		if l := currentMeteredLedger(); l != nil {
+			collect(l, emit)
+		}
+	}, labels...)
+}
+
+// setMeteredLedger sets the ledger reported by the memory gauges
+func setMeteredLedger(l *ledger) {
+	meteredLedger.Lock()
+	defer meteredLedger.Unlock()
+	meteredLedger.ledger = l
+}
+
+// currentMeteredLedger returns the ledger reported by the memory gauges, nil before initialization
+func currentMeteredLedger() *ledger {
+	meteredLedger.Lock()
+	defer meteredLedger.Unlock()
+	return meteredLedger.ledger
+}
+
+// countDockerError counts a failed docker API call, it does nothing for successful calls
+func countDockerError(operation string, err error) {
+	if err != nil {
+		dockerAPIErrors.Inc(operation)
+	}
+}
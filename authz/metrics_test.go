@@ -0,0 +1,53 @@
+package authz
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/AuthzMemory/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedgerMetrics(t *testing.T) {
+
+	l := newLedger()
+	l.setCapacity(containerCost{Memory: 8 << 30})
+	l.setTenantQuotas(map[string]int64{"team-a": 4 << 30})
+
+	// team-a was admitted a container not created yet, team-b one that was created
+	pending := ledgerEntry{Cost: containerCost{Memory: 1 << 30}, Tenant: "team-a"}
+	created := ledgerEntry{Cost: containerCost{Memory: 2 << 30}, Tenant: "team-b"}
+	ok, _ := l.admit(pending)
+	assert.True(t, ok)
+	ok, _ = l.admit(created)
+	assert.True(t, ok)
+	l.record("4fa6e0f0c678", created)
+
+	host, tenants := l.memoryUsage()
+	assert.Equal(t, memoryUsage{Committed: 2 << 30, Pending: 1 << 30}, host)
+	assert.Equal(t, map[string]memoryUsage{
+		"team-a": {Pending: 1 << 30},
+		"team-b": {Committed: 2 << 30},
+	}, tenants)
+
+	// the container is released before the ledger is reconciled
+	l.release("4fa6e0f0c678")
+	host, _ = l.memoryUsage()
+	assert.Equal(t, memoryUsage{Pending: 1 << 30}, host)
+
+	setMeteredLedger(l)
+	defer setMeteredLedger(nil)
+	var buf bytes.Buffer
+	assert.NoError(t, metrics.DefaultRegistry.WriteText(&buf))
+	for _, line := range []string{
+		"authz_broker_memory_capacity_bytes 8589934592\n",
+		"authz_broker_memory_committed_bytes 0\n",
+		"authz_broker_memory_pending_bytes 1073741824\n",
+		`authz_broker_tenant_memory_pending_bytes{tenant="team-a"} 1073741824` + "\n",
+		`authz_broker_tenant_memory_quota_bytes{tenant="team-a"} 4294967296` + "\n",
+		fmt.Sprintf("authz_broker_event_stream_reconnects_total %v\n", eventStreamReconnects.Value()),
+	} {
+		assert.Contains(t, buf.String(), line)
+	}
+}
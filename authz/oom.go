@@ -0,0 +1,208 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AuthzMemory/core"
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/go-units"
+	"golang.org/x/net/context"
+)
+
+// maxOOMRecords bounds the OOM kill history kept in memory
+const maxOOMRecords = 1000
+
+// defaultOOMWindow is the period OOM kills are counted over by the repeat offender policy
+const defaultOOMWindow = 24 * time.Hour
+
+// oomRecord describes a single OOM kill
+type oomRecord struct {
+	Time      time.Time `json:"time"`
+	Container string    `json:"container"`
+	Image     string    `json:"image"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Limit     int64     `json:"limit"`
+}
+
+// oomSummary is the answer of the OOM admin query
+type oomSummary struct {
+	ByContainer map[string]int `json:"by_container"`
+	ByImage     map[string]int `json:"by_image"`
+	ByTenant    map[string]int `json:"by_tenant"`
+	Recent      []oomRecord    `json:"recent"`
+}
+
+// oomTracker keeps the OOM kill history of the host
+type oomTracker struct {
+	sync.Mutex
+	records     []oomRecord          // records are the most recent OOM kills, oldest first
+	byContainer map[string]int       // byContainer counts OOM kills by container id
+	byImage     map[string]int       // byImage counts OOM kills by image
+	byTenant    map[string]int       // byTenant counts OOM kills by tenant
+	last        map[string]time.Time // last is the time of the last OOM kill of every container
+}
+
+// newOOMTracker creates an empty OOM kill history
+func newOOMTracker() *oomTracker {
+	return &oomTracker{
+		byContainer: make(map[string]int),
+		byImage:     make(map[string]int),
+		byTenant:    make(map[string]int),
+		last:        make(map[string]time.Time),
+	}
+}
+
+// add records an OOM kill
+func (t *oomTracker) add(record oomRecord) {
+	t.Lock()
+	defer t.Unlock()
+	t.records = append(t.records, record)
+	if len(t.records) > maxOOMRecords {
+		t.records = t.records[len(t.records)-maxOOMRecords:]
+	}
+	t.byContainer[record.Container]++
+	t.byImage[record.Image]++
+	if record.Tenant != "" {
+		t.byTenant[record.Tenant]++
+	}
+	t.last[record.Container] = record.Time
+}
+
+// lastKill returns the time of the last recorded OOM kill of the given container
+func (t *oomTracker) lastKill(id string) time.Time {
+	t.Lock()
+	defer t.Unlock()
+	return t.last[id]
+}
+
+// imageFailures returns the number of OOM kills of an image with a memory limit since the given time and the largest
+// limit it was killed with, kills of containers without a limit (host OOM kills) say nothing about the limit to request
+func (t *oomTracker) imageFailures(image string, since time.Time) (int, int64) {
+	t.Lock()
+	defer t.Unlock()
+	var count int
+	var largest int64
+	for _, record := range t.records {
+		if record.Image != image || record.Time.Before(since) || record.Limit == 0 {
+			continue
+		}
+		count++
+		if record.Limit > largest {
+			largest = record.Limit
+		}
+	}
+	return count, largest
+}
+
+// summary returns the OOM kill counters and the records matching the given image and tenant filters
+func (t *oomTracker) summary(image, tenant string) oomSummary {
+	t.Lock()
+	defer t.Unlock()
+	summary := oomSummary{
+		ByContainer: make(map[string]int),
+		ByImage:     make(map[string]int),
+		ByTenant:    make(map[string]int),
+		Recent:      []oomRecord{},
+	}
+	for k, v := range t.byContainer {
+		summary.ByContainer[k] = v
+	}
+	for k, v := range t.byImage {
+		summary.ByImage[k] = v
+	}
+	for k, v := range t.byTenant {
+		summary.ByTenant[k] = v
+	}
+	for _, record := range t.records {
+		if (image == "" || record.Image == image) && (tenant == "" || record.Tenant == tenant) {
+			summary.Recent = append(summary.Recent, record)
+		}
+	}
+	return summary
+}
+
+// handleOOMEvent records the OOM kills reported by "oom" events, and by "die" events of
+// containers the kernel killed without a matching "oom" event in their current run
+func (f *basicAuthorizer) handleOOMEvent(msg events.Message) {
+	cJSON, err := f.cli.ContainerInspect(context.Background(), msg.ID)
+	countDockerError(dockerContainerInspect, err)
+	if err != nil || cJSON.ContainerJSONBase == nil {
+		logrus.Errorf("Failed to inspect OOM killed container %s: %v", msg.ID, err)
+		return
+	}
+
+	if msg.Action == "die" {
+		if cJSON.State == nil || !cJSON.State.OOMKilled {
+			return
+		}
+		started, _ := time.Parse(time.RFC3339Nano, cJSON.State.StartedAt)
+		if f.ooms.lastKill(cJSON.ID).After(started) {
+			return
+		}
+	}
+
+	record := oomRecord{
+		Time:      time.Unix(0, msg.TimeNano),
+		Container: cJSON.ID,
+		Image:     imageKey(msg.Actor.Attributes["image"]),
+		Tenant:    core.ResourceTenant(cJSON.ID),
+	}
+	if msg.TimeNano == 0 {
+		record.Time = time.Now()
+	}
+	if cJSON.Config != nil && record.Image == "" {
+		record.Image = imageKey(cJSON.Config.Image)
+	}
+	if cJSON.HostConfig != nil {
+		record.Limit = cJSON.HostConfig.Memory
+	}
+	f.ooms.add(record)
+	logrus.Warnf("Container %s of image %s (tenant %q) was OOM killed with a memory limit of %s",
+		record.Container, record.Image, record.Tenant, units.BytesSize(float64(record.Limit)))
+}
+
+// checkOOMHistory denies creating a container of an image that was repeatedly OOM killed
+// with a limit no larger than the one it was killed with
+func (f *basicAuthorizer) checkOOMHistory(image string, memory int64) string {
+	if f.settings.OOMRepeatCount <= 0 || image == "" {
+		return ""
+	}
+	window := f.settings.OOMWindow
+	if window == 0 {
+		window = defaultOOMWindow
+	}
+	image = imageKey(image)
+	count, largest := f.ooms.imageFailures(image, time.Now().Add(-window))
+	if count < f.settings.OOMRepeatCount || memory > largest {
+		return ""
+	}
+	return fmt.Sprintf("Image %s was OOM killed %d times in the last %s with limits up to %s, request a larger limit (e.g. -m %s)",
+		image, count, window, units.BytesSize(float64(largest)), units.BytesSize(float64(2*largest)))
+}
+
+// serveOOMs answers the OOM admin query, optionally filtered by image and tenant
+func (f *basicAuthorizer) serveOOMs(w http.ResponseWriter, r *http.Request) {
+	image := r.URL.Query().Get("image")
+	if image != "" {
+		image = imageKey(image)
+	}
+	summary := f.ooms.summary(image, r.URL.Query().Get("tenant"))
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		logrus.Errorf("Failed to write OOM summary: %v", err)
+	}
+}
+
+// AdminRoutes exposes the administrative queries of the basic authorizer
+func (f *basicAuthorizer) AdminRoutes() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"ooms":            f.serveOOMs,
+		"recommendations": f.serveRecommendations,
+		"unmatched":       f.serveUnmatched,
+		"would-deny":      f.serveWouldDeny,
+	}
+}
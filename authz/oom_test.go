@@ -0,0 +1,51 @@
+package authz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOOMRepeatOffender(t *testing.T) {
+
+	f := &basicAuthorizer{
+		settings: &BasicAuthorizerSettings{OOMRepeatCount: 2, OOMWindow: time.Hour},
+		ooms:     newOOMTracker(),
+	}
+
+	f.ooms.add(oomRecord{Time: time.Now().Add(-2 * time.Hour), Container: "old", Image: "elasticsearch:latest", Limit: 1 << 30})
+	f.ooms.add(oomRecord{Time: time.Now(), Container: "a", Image: "elasticsearch:latest", Tenant: "search", Limit: 256 << 20})
+	assert.Equal(t, "", f.checkOOMHistory("elasticsearch", 256<<20))
+
+	f.ooms.add(oomRecord{Time: time.Now(), Container: "b", Image: "elasticsearch:latest", Tenant: "search", Limit: 512 << 20})
+	assert.Equal(t, "Image elasticsearch:latest was OOM killed 2 times in the last 1h0m0s with limits up to 512 MiB, request a larger limit (e.g. -m 1 GiB)",
+		f.checkOOMHistory("elasticsearch", 512<<20))
+	assert.Equal(t, "", f.checkOOMHistory("elasticsearch", 1<<30))
+	assert.Equal(t, "", f.checkOOMHistory("elasticsearch:5", 256<<20))
+
+	summary := f.ooms.summary("", "search")
+	assert.Equal(t, 3, summary.ByImage["elasticsearch:latest"])
+	assert.Equal(t, 2, summary.ByTenant["search"])
+	assert.Len(t, summary.Recent, 2)
+}
+
+func TestOOMRepeatOffenderWithoutLimit(t *testing.T) {
+
+	f := &basicAuthorizer{
+		settings: &BasicAuthorizerSettings{OOMRepeatCount: 2, OOMWindow: time.Hour},
+		ooms:     newOOMTracker(),
+	}
+
+	// host OOM kills of containers without a limit do not count against the image
+	f.ooms.add(oomRecord{Time: time.Now(), Container: "a", Image: "redis:latest"})
+	f.ooms.add(oomRecord{Time: time.Now(), Container: "b", Image: "redis:latest"})
+	assert.Equal(t, "", f.checkOOMHistory("redis", 0))
+	assert.Equal(t, "", f.checkOOMHistory("redis", 128<<20))
+
+	f.ooms.add(oomRecord{Time: time.Now(), Container: "c", Image: "redis:latest", Limit: 128 << 20})
+	assert.Equal(t, "", f.checkOOMHistory("redis", 128<<20))
+	f.ooms.add(oomRecord{Time: time.Now(), Container: "d", Image: "redis:latest", Limit: 64 << 20})
+	assert.Equal(t, "Image redis:latest was OOM killed 2 times in the last 1h0m0s with limits up to 128 MiB, request a larger limit (e.g. -m 256 MiB)",
+		f.checkOOMHistory("redis", 128<<20))
+}
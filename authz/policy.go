@@ -0,0 +1,320 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/AuthzMemory/core"
+	"github.com/AuthzMemory/expr"
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/engine-api/types/swarm"
+)
+
+const (
+	// PolicyEffectAllow stops the rule evaluation and lets the memory checks decide
+	PolicyEffectAllow = "allow"
+	// PolicyEffectDeny denies the matching requests
+	PolicyEffectDeny = "deny"
+)
+
+// defaultPolicyPollInterval is the delay between two checks of the policy file modification time
+const defaultPolicyPollInterval = 10 * time.Second
+
+// Policy is the declarative configuration of the basic authorizer, it overrides the matching settings
+type Policy struct {
+	Capacity PolicyCapacity        `json:"capacity"`         // Capacity overrides the memory capacities
+	Quotas   map[string]MemorySize `json:"quotas,omitempty"` // Quotas are the memory quotas of the tenants
+	Rules    []PolicyRule          `json:"rules,omitempty"`  // Rules are evaluated in order, the first matching rule applies
+	Images   []ImageRule           `json:"images,omitempty"` // Images replace the image rules when not empty
+	Defaults PolicyDefaults        `json:"defaults"`         // Defaults are the default memory limits
+}
+
+// PolicyCapacity overrides the memory capacities of the settings, zero keeps the setting
+type PolicyCapacity struct {
+	Memory         MemorySize `json:"memory,omitempty"`           // Memory is the memory available for containers
+	Burst          MemorySize `json:"burst,omitempty"`            // Burst is the capacity shared by burstable containers
+	BestEffortPool MemorySize `json:"best_effort_pool,omitempty"` // BestEffortPool is the pool shared by best effort containers
+}
+
+// PolicyDefaults overrides the default memory limits of the settings, zero keeps the setting
+type PolicyDefaults struct {
+	MemoryLimit        MemorySize            `json:"memory_limit,omitempty"`         // MemoryLimit is the global default limit
+	TenantMemoryLimits map[string]MemorySize `json:"tenant_memory_limits,omitempty"` // TenantMemoryLimits are the per tenant default limits
+}
+
+// PolicyRule matches requests on their user, tenant, action, image, labels and condition, every empty criteria
+// matches anything and users, tenants and actions are shell globs
+type PolicyRule struct {
+	Name    string            `json:"name"`              // Name identifies the rule in deny messages
+	Effect  string            `json:"effect"`            // Effect is applied to the matching requests (allow, deny)
+	Message string            `json:"message,omitempty"` // Message is appended to the deny message
+	Users   []string          `json:"users,omitempty"`   // Users are the user patterns the rule applies to
+	Tenants []string          `json:"tenants,omitempty"` // Tenants are the tenant patterns the rule applies to
+	Actions []string          `json:"actions,omitempty"` // Actions are the action patterns the rule applies to (e.g. "container_*")
+	Images  []string          `json:"images,omitempty"`  // Images are the image reference patterns the rule applies to
+	Labels  map[string]string `json:"labels,omitempty"`  // Labels are the label value patterns the requested resource must carry
+	When    string            `json:"when,omitempty"`    // When is a condition on the request (e.g. body.HostConfig.Privileged)
+	Audit   bool              `json:"audit,omitempty"`   // Audit only logs and counts the requests a deny rule matches
+
+	images []ImageRule // images are the compiled image patterns
+	when   *expr.Expr  // when is the compiled condition
+}
+
+// compile validates the rule
+func (r *PolicyRule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("Policy rule has no name")
+	}
+	if r.Effect != PolicyEffectAllow && r.Effect != PolicyEffectDeny {
+		return fmt.Errorf("Invalid effect %q in policy rule %q", r.Effect, r.Name)
+	}
+	for _, patterns := range [][]string{r.Users, r.Tenants, r.Actions} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Invalid pattern %q in policy rule %q: %v", pattern, r.Name, err)
+			}
+		}
+	}
+	for _, pattern := range r.Labels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid label pattern %q in policy rule %q: %v", pattern, r.Name, err)
+		}
+	}
+	r.images = nil
+	for _, image := range r.Images {
+		rule := ImageRule{Image: image}
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("Invalid image in policy rule %q: %v", r.Name, err)
+		}
+		r.images = append(r.images, rule)
+	}
+	r.when = nil
+	if r.When != "" {
+		when, err := expr.Compile(r.When, conditionEnv{})
+		if err != nil {
+			return fmt.Errorf("Invalid condition in policy rule %q: %v", r.Name, err)
+		}
+		r.when = when
+	}
+	return nil
+}
+
+// matchesAny returns whether the value matches one of the patterns, or whether there are no patterns
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return len(patterns) == 0
+}
+
+// matches returns whether the rule applies to the request, and the error of a condition failing to evaluate
+func (r *PolicyRule) matches(env conditionEnv) (bool, error) {
+	req, target := env.req, env.target
+	if !matchesAny(r.Users, req.User) || !matchesAny(r.Tenants, req.Tenant) || !matchesAny(r.Actions, req.Action) {
+		return false, nil
+	}
+	if len(r.images) > 0 {
+		matched := false
+		for i := range r.images {
+			if target.image != "" && r.images[i].matches(target.image) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	for name, pattern := range r.Labels {
+		value, ok := target.labels[name]
+		if !ok {
+			return false, nil
+		}
+		if matched, _ := path.Match(pattern, value); !matched {
+			return false, nil
+		}
+	}
+	if r.when != nil {
+		matched, err := r.when.Bool(env)
+		if err != nil {
+			logrus.Warnf("Failed to evaluate the condition of policy rule %q on %s %s: %v", r.Name, req.RequestMethod, req.RequestURI, err)
+			return false, err
+		}
+		return matched, nil
+	}
+	return true, nil
+}
+
+// validate compiles and checks the policy
+func (p *Policy) validate() error {
+	for name, quota := range p.Quotas {
+		if quota < 0 {
+			return fmt.Errorf("Invalid negative quota for tenant %q", name)
+		}
+	}
+	names := make(map[string]bool)
+	for i := range p.Rules {
+		if err := p.Rules[i].compile(); err != nil {
+			return err
+		}
+		if names[p.Rules[i].Name] {
+			return fmt.Errorf("Duplicate policy rule %q", p.Rules[i].Name)
+		}
+		names[p.Rules[i].Name] = true
+	}
+	return compileImageRules(p.Images)
+}
+
+// LoadPolicy reads and validates a JSON policy file
+func LoadPolicy(file string) (*Policy, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := json.Unmarshal(content, &policy); err != nil {
+		return nil, fmt.Errorf("Failed to parse policy %s: %v", file, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid policy %s: %v", file, err)
+	}
+	return &policy, nil
+}
+
+// policy returns the current policy, nil without policy file
+func (f *basicAuthorizer) policy() *Policy {
+	policy, _ := f.currentPolicy.Load().(*Policy)
+	return policy
+}
+
+// applyPolicy atomically replaces the current policy and applies its quotas and capacities
+func (f *basicAuthorizer) applyPolicy(policy *Policy) {
+	f.currentPolicy.Store(policy)
+	quotas := make(map[string]int64, len(policy.Quotas))
+	for tenant, quota := range policy.Quotas {
+		quotas[tenant] = int64(quota)
+	}
+	f.ledger.setTenantQuotas(quotas)
+	f.applyCapacity()
+}
+
+// reloadPolicy loads the policy file again, keeping the current policy if the new one is invalid
+func (f *basicAuthorizer) reloadPolicy() {
+	policy, err := LoadPolicy(f.settings.PolicyFile)
+	if err != nil {
+		logrus.Errorf("Failed to reload policy, keeping the previous one: %v", err)
+		return
+	}
+	f.applyPolicy(policy)
+	logrus.Infof("Reloaded policy %s with %d rules and %d quotas", f.settings.PolicyFile, len(policy.Rules), len(policy.Quotas))
+}
+
+// watchPolicy reloads the policy file on SIGHUP and whenever its modification time changes
+func (f *basicAuthorizer) watchPolicy() {
+	interval := f.settings.PolicyPollInterval
+	if interval == 0 {
+		interval = defaultPolicyPollInterval
+	}
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	var modified time.Time
+	if stat, err := os.Stat(f.settings.PolicyFile); err == nil {
+		modified = stat.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	for {
+		select {
+		case <-hangups:
+			f.reloadPolicy()
+		case <-ticker.C:
+			stat, err := os.Stat(f.settings.PolicyFile)
+			if err != nil || stat.ModTime().Equal(modified) {
+				continue
+			}
+			modified = stat.ModTime()
+			f.reloadPolicy()
+		}
+	}
+}
+
+// requestTarget is the image and labels of the resource a request creates
+type requestTarget struct {
+	image  string
+	labels map[string]string
+}
+
+// targetOf extracts the image and labels of the resource a request creates
+func targetOf(req *core.RequestContext) requestTarget {
+	switch req.Action {
+	case core.ActionContainerCreate:
+		if request, err := decodeCreateRequest(req); err == nil {
+			return requestTarget{image: request.Image, labels: request.Labels}
+		}
+	case core.ActionServiceCreate, core.ActionServiceUpdate:
+		var spec swarm.ServiceSpec
+		if err := req.DecodeBody(&spec); err == nil {
+			labels := make(map[string]string)
+			for name, value := range spec.Labels {
+				labels[name] = value
+			}
+			for name, value := range spec.TaskTemplate.ContainerSpec.Labels {
+				labels[name] = value
+			}
+			return requestTarget{image: spec.TaskTemplate.ContainerSpec.Image, labels: labels}
+		}
+	case core.ActionImageCreate:
+		image := req.Query.Get("fromImage")
+		if tag := req.Query.Get("tag"); image != "" && tag != "" {
+			image += ":" + tag
+		}
+		return requestTarget{image: image}
+	}
+	return requestTarget{}
+}
+
+// checkPolicyRules applies the first policy rule matching the request, returning the name of the denying rule
+// and its deny message, or empty strings. Deny rules in audit mode record the would-be denial and the evaluation
+// goes on with the next rules
+func (f *basicAuthorizer) checkPolicyRules(req *core.RequestContext) (string, string) {
+	policy := f.policy()
+	if policy == nil || len(policy.Rules) == 0 {
+		return "", ""
+	}
+	env := conditionEnv{f: f, req: req, target: targetOf(req), hostConfig: normalizedHostConfig(req)}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		matched, err := rule.matches(env)
+		if err != nil && rule.Effect == PolicyEffectDeny {
+			// a deny rule failing to evaluate fails closed
+			matched = true
+		}
+		if !matched {
+			continue
+		}
+		if rule.Effect == PolicyEffectAllow {
+			return "", ""
+		}
+		msg := fmt.Sprintf("Request denied by policy rule %q", rule.Name)
+		if rule.Message != "" {
+			msg = fmt.Sprintf("%s: %s", msg, rule.Message)
+		}
+		if err != nil {
+			msg = fmt.Sprintf("%s (condition failed to evaluate: %v)", msg, err)
+		}
+		if rule.Audit {
+			f.wouldDeny.record(req, policyCheckPrefix+rule.Name, msg)
+			continue
+		}
+		return rule.Name, msg
+	}
+	return "", ""
+}
@@ -0,0 +1,162 @@
+package authz
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AuthzMemory/core"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyRules(t *testing.T) {
+
+	policy, err := LoadPolicy("testdata/policy/policy.json")
+	assert.NoError(t, err)
+	f := &basicAuthorizer{settings: &BasicAuthorizerSettings{}, ledger: newLedger()}
+	f.applyPolicy(policy)
+
+	tests := []struct {
+		uri         string
+		tenant      string
+		body        string
+		expectedMsg string
+	}{
+		{"/v1.24/containers/create", "team-b", `{"Image":"busybox:latest"}`, `Request denied by policy rule "no-latest": pin an image tag`},
+		{"/v1.24/containers/create", "team-b", `{"Image":"busybox"}`, `Request denied by policy rule "no-latest": pin an image tag`},
+		{"/v1.24/containers/create", "infra", `{"Image":"busybox"}`, ""},
+		{"/v1.24/containers/create", "team-b", `{"Image":"busybox:1.25"}`, ""},
+		{"/v1.24/containers/create", "team-b", `{"Image":"busybox:1.25","Labels":{"pci":"yes"}}`, `Request denied by policy rule "pci-only-team-a"`},
+		{"/v1.24/containers/create", "team-a", `{"Image":"busybox:1.25","Labels":{"pci":"yes"}}`, ""},
+		{"/v1.24/services/create", "team-b", `{"TaskTemplate":{"ContainerSpec":{"Image":"busybox:1.25","Labels":{"pci":"1"}}}}`, `Request denied by policy rule "pci-only-team-a"`},
+		{"/v1.24/containers/create", "team-b", `{"Image":"busybox:1.25","HostConfig":{"Privileged":true}}`, `Request denied by policy rule "no-privileged"`},
+		{"/v1.24/containers/create", "team-b", `{"Image":"busybox:1.25","HostConfig":{"Privileged":false}}`, ""},
+		{"/v1.24/containers/create", "team-b", `{"Image":"busybox:1.25","hostconfig":{"privileged":true}}`, `Request denied by policy rule "no-privileged"`},
+		{"/v1.24/containers/create", "team-b", `{"Image":"busybox:1.25","Privileged":true}`, `Request denied by policy rule "no-privileged"`},
+		{"/v1.24/containers/create", "team-b", `{"Image":"busybox:1.25","HostConfig":{},"Privileged":true}`, ""},
+		{"/v1.24/containers/create", "team-a", `{"Image":"busybox:1.25","HostConfig":{"Memory":536870912}}`, ""},
+		{"/v1.24/containers/create", "team-a", `{"Image":"busybox:1.25","HostConfig":{"Memory":1073741825}}`, `Request denied by policy rule "tenant-headroom"`},
+		{"/v1.24/containers/create", "team-a", `{"Image":"busybox:1.25","Memory":1073741825}`, `Request denied by policy rule "tenant-headroom"`},
+		{"/v1.19/containers/create", "team-a", `{"Image":"busybox:1.25","HostConfig":{"memory":0},"Memory":1073741825}`, `Request denied by policy rule "tenant-headroom"`},
+		{"/v1.24/containers/create", "team-b", `{"Image":"busybox:1.25","HostConfig":{"Memory":1073741825}}`, ""},
+		{"/v1.24/swarm/leave", "team-a", ``, `Request denied by policy rule "no-swarm-changes"`},
+		{"/v1.24/containers/json", "team-a", ``, ""},
+	}
+
+	for _, test := range tests {
+		req := core.NewRequestContext(&authorization.Request{
+			User:           "alice",
+			RequestMethod:  "POST",
+			RequestURI:     test.uri,
+			RequestBody:    []byte(test.body),
+			RequestHeaders: map[string]string{core.TenantIDHeaderName: test.tenant},
+		})
+		if req.Action == core.ActionContainerList {
+			req = core.NewRequestContext(&authorization.Request{RequestMethod: "GET", RequestURI: test.uri})
+		}
+		_, msg := f.checkPolicyRules(req)
+		assert.Equal(t, test.expectedMsg, msg, "%s %s %s", test.uri, test.tenant, test.body)
+	}
+
+	limit, source := f.defaultLimit("busybox", "team-a")
+	assert.Equal(t, int64(256<<20), limit)
+	assert.Equal(t, "tenant team-a", source)
+	limit, _ = f.defaultLimit("busybox", "team-b")
+	assert.Equal(t, int64(512<<20), limit)
+
+	f.ledger.setCapacity(containerCost{Memory: int64(policy.Capacity.Memory)})
+	ok, msg := f.ledger.admit(ledgerEntry{Cost: containerCost{Memory: 768 << 20}, Tenant: "team-a"})
+	assert.True(t, ok)
+	ok, msg = f.ledger.admit(ledgerEntry{Cost: containerCost{Memory: 512 << 20}, Tenant: "team-a"})
+	assert.False(t, ok)
+	assert.Equal(t, "Tenant team-a memory quota of 1 GiB exceeded", msg)
+}
+
+func TestPolicyReload(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "policy")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "policy.json")
+
+	copyFile := func(src string) {
+		content, err := ioutil.ReadFile(src)
+		assert.NoError(t, err)
+		assert.NoError(t, ioutil.WriteFile(file, content, 0644))
+	}
+
+	copyFile("testdata/policy/policy.json")
+	f := &basicAuthorizer{settings: &BasicAuthorizerSettings{PolicyFile: file}, ledger: newLedger()}
+	policy, err := LoadPolicy(file)
+	assert.NoError(t, err)
+	f.applyPolicy(policy)
+
+	copyFile("testdata/policy/invalid.json")
+	f.reloadPolicy()
+	assert.Equal(t, policy, f.policy())
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"quotas":{"team-a":"2g"}}`), 0644))
+	f.reloadPolicy()
+	assert.Empty(t, f.policy().Rules)
+	_, quota := f.ledger.tenantUsage("team-a")
+	assert.Equal(t, int64(2<<30), quota)
+
+	_, err = LoadPolicy("testdata/policy/invalid.json")
+	assert.EqualError(t, err, `Invalid policy testdata/policy/invalid.json: Invalid effect "maybe" in policy rule "broken"`)
+	_, err = LoadPolicy("testdata/policy/invalid_condition.json")
+	assert.EqualError(t, err, `Invalid policy testdata/policy/invalid_condition.json: Invalid condition in policy rule "privileged": `+
+		`unknown variable tenant.memory.free, expected tenant.memory.used|quota at column 31`)
+}
+
+func TestPolicyConditions(t *testing.T) {
+
+	tests := []struct {
+		when        string
+		body        string
+		expectedMsg string
+	}{
+		{`body.HostConfig.Memory == 0`, `{"Image":"busybox","HostConfig":{"Memory":0}}`, `Request denied by policy rule "rule"`},
+		{`body.HostConfig.Memory == 0`, `{"Image":"busybox"}`, `Request denied by policy rule "rule"`},
+		{`body.HostConfig.Memory == 0`, `{"Image":"busybox","Memory":268435456}`, ""},
+		{`!(body.HostConfig.Memory > 0)`, `{"Image":"busybox","HostConfig":{"Memory":0}}`, `Request denied by policy rule "rule"`},
+		{`body.HostConfig.Memory > 8g`, `{"Image":"busybox","HostConfig":{"Memory":0}}`, ""},
+		{`body.HostConfig.Memory > 8g`, `{"Image":"busybox","hostconfig":{"memory":17179869184}}`, `Request denied by policy rule "rule"`},
+		{`body.HostConfig.Privileged`, `{"Image":"busybox","HostConfig":{"Memory":0}}`, ""},
+		// a deny rule whose condition fails to evaluate denies
+		{`body.Cmd > 1`, `{"Image":"busybox"}`, `Request denied by policy rule "rule" (condition failed to evaluate: `},
+	}
+
+	for _, test := range tests {
+		policy := &Policy{Rules: []PolicyRule{{Name: "rule", Effect: PolicyEffectDeny, Actions: []string{core.ActionContainerCreate}, When: test.when}}}
+		assert.NoError(t, policy.validate())
+		f := &basicAuthorizer{settings: &BasicAuthorizerSettings{}, ledger: newLedger()}
+		f.applyPolicy(policy)
+		_, msg := f.checkPolicyRules(core.NewRequestContext(&authorization.Request{
+			RequestMethod: "POST",
+			RequestURI:    "/v1.24/containers/create",
+			RequestBody:   []byte(test.body),
+		}))
+		if test.expectedMsg == "" {
+			assert.Equal(t, "", msg, "%s %s", test.when, test.body)
+			continue
+		}
+		assert.Contains(t, msg, test.expectedMsg, "%s %s", test.when, test.body)
+	}
+
+	// an allow rule whose condition fails to evaluate does not allow
+	policy := &Policy{Rules: []PolicyRule{
+		{Name: "allow", Effect: PolicyEffectAllow, When: `body.Cmd > 1`},
+		{Name: "deny", Effect: PolicyEffectDeny},
+	}}
+	assert.NoError(t, policy.validate())
+	f := &basicAuthorizer{settings: &BasicAuthorizerSettings{}, ledger: newLedger()}
+	f.applyPolicy(policy)
+	rule, _ := f.checkPolicyRules(core.NewRequestContext(&authorization.Request{
+		RequestMethod: "POST",
+		RequestURI:    "/v1.24/containers/create",
+		RequestBody:   []byte(`{"Image":"busybox"}`),
+	}))
+	assert.Equal(t, "deny", rule)
+}
@@ -0,0 +1,125 @@
+package authz
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/AuthzMemory/core"
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/go-units"
+)
+
+// defaultPressurePath is the kernel memory pressure stall information file
+const defaultPressurePath = "/proc/pressure/memory"
+
+// defaultPressureWindow is the PSI average compared with the thresholds
+const defaultPressureWindow = "avg10"
+
+// memoryConsumingActions are the actions refused while the host is under memory pressure
+var memoryConsumingActions = map[string]bool{
+	core.ActionContainerCreate:     true,
+	core.ActionContainerStart:      true,
+	core.ActionContainerRestart:    true,
+	core.ActionContainerUnpause:    true,
+	core.ActionContainerExecCreate: true,
+	core.ActionImageBuild:          true,
+}
+
+// memoryPressure holds the memory pressure stall averages of the host, in percents
+type memoryPressure struct {
+	Some map[string]float64 // Some is the share of time at least one task stalled on memory
+	Full map[string]float64 // Full is the share of time all non idle tasks stalled on memory
+}
+
+// readPressure parses a PSI formatted file such as /proc/pressure/memory
+func readPressure(path string) (*memoryPressure, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pressure := &memoryPressure{Some: make(map[string]float64), Full: make(map[string]float64)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Lines look like "some avg10=0.00 avg60=0.00 avg300=0.00 total=0"
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 0 {
+			continue
+		}
+		var averages map[string]float64
+		switch parts[0] {
+		case "some":
+			averages = pressure.Some
+		case "full":
+			averages = pressure.Full
+		default:
+			continue
+		}
+		for _, part := range parts[1:] {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid pressure value %q in %s", part, path)
+			}
+			averages[kv[0]] = value
+		}
+	}
+	return pressure, scanner.Err()
+}
+
+// pressureGateEnabled returns whether any host memory pressure threshold is configured
+func (f *basicAuthorizer) pressureGateEnabled() bool {
+	return f.settings.PressureSomeThreshold > 0 || f.settings.PressureFullThreshold > 0 || f.settings.MinMemAvailable > 0
+}
+
+// checkPressure returns the reason the host is under memory pressure, or an empty string if it is not,
+// a gate that cannot read its sources does not deny since the declared-limit ledger still applies
+func (f *basicAuthorizer) checkPressure() string {
+	if f.settings.PressureSomeThreshold > 0 || f.settings.PressureFullThreshold > 0 {
+		path := f.settings.PressurePath
+		if path == "" {
+			path = defaultPressurePath
+		}
+		window := f.settings.PressureWindow
+		if window == "" {
+			window = defaultPressureWindow
+		}
+		pressure, err := readPressure(path)
+		if err != nil {
+			logrus.Errorf("Failed to read memory pressure: %v", err)
+		} else {
+			if some := pressure.Some[window]; f.settings.PressureSomeThreshold > 0 && some >= f.settings.PressureSomeThreshold {
+				return fmt.Sprintf("Host under memory pressure: some %s=%.2f exceeds %.2f", window, some, f.settings.PressureSomeThreshold)
+			}
+			if full := pressure.Full[window]; f.settings.PressureFullThreshold > 0 && full >= f.settings.PressureFullThreshold {
+				return fmt.Sprintf("Host under memory pressure: full %s=%.2f exceeds %.2f", window, full, f.settings.PressureFullThreshold)
+			}
+		}
+	}
+
+	if f.settings.MinMemAvailable > 0 {
+		meminfo, err := readMeminfo(f.meminfoPath())
+		if err != nil {
+			logrus.Errorf("Failed to read host memory information: %v", err)
+		} else if available, ok := meminfo["MemAvailable"]; ok && available < f.settings.MinMemAvailable {
+			return fmt.Sprintf("Host under memory pressure: MemAvailable %s is below %s",
+				units.BytesSize(float64(available)), units.BytesSize(float64(f.settings.MinMemAvailable)))
+		}
+	}
+	return ""
+}
+
+// meminfoPath returns the configured meminfo path
+func (f *basicAuthorizer) meminfoPath() string {
+	if f.settings.MeminfoPath == "" {
+		return defaultMeminfoPath
+	}
+	return f.settings.MeminfoPath
+}
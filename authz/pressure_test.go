@@ -0,0 +1,45 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadFixtures(t *testing.T) {
+
+	meminfo, err := readMeminfo("testdata/meminfo")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(524288*1024), meminfo["MemAvailable"])
+	assert.Equal(t, int64(2097152*1024), meminfo["SwapTotal"])
+	assert.Equal(t, int64(0), meminfo["HugePages_Total"])
+
+	pressure, err := readPressure("testdata/pressure")
+	assert.NoError(t, err)
+	assert.Equal(t, 35.20, pressure.Some["avg10"])
+	assert.Equal(t, 1.50, pressure.Full["avg60"])
+}
+
+func TestCheckPressure(t *testing.T) {
+
+	tests := []struct {
+		settings    BasicAuthorizerSettings
+		expectedMsg string
+	}{
+		{BasicAuthorizerSettings{PressureSomeThreshold: 40}, ""},
+		{BasicAuthorizerSettings{PressureSomeThreshold: 20}, "Host under memory pressure: some avg10=35.20 exceeds 20.00"},
+		{BasicAuthorizerSettings{PressureSomeThreshold: 20, PressureWindow: "avg300"}, ""},
+		{BasicAuthorizerSettings{PressureFullThreshold: 5}, "Host under memory pressure: full avg10=5.00 exceeds 5.00"},
+		{BasicAuthorizerSettings{MinMemAvailable: 256 * 1024 * 1024}, ""},
+		{BasicAuthorizerSettings{MinMemAvailable: 1024 * 1024 * 1024}, "Host under memory pressure: MemAvailable 512 MiB is below 1 GiB"},
+	}
+
+	for _, test := range tests {
+		settings := test.settings
+		settings.PressurePath = "testdata/pressure"
+		settings.MeminfoPath = "testdata/meminfo"
+		f := &basicAuthorizer{settings: &settings}
+		assert.True(t, f.pressureGateEnabled())
+		assert.Equal(t, test.expectedMsg, f.checkPressure())
+	}
+}
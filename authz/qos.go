@@ -0,0 +1,47 @@
+package authz
+
+import "github.com/docker/engine-api/types/container"
+
+const (
+	// QoSGuaranteed is the class of containers whose memory reservation equals their limit
+	QoSGuaranteed = "guaranteed"
+	// QoSBurstable is the class of containers whose memory reservation is lower than their limit
+	QoSBurstable = "burstable"
+	// QoSBestEffort is the class of containers without a memory limit
+	QoSBestEffort = "best-effort"
+)
+
+// defaultBestEffortCharge is the amount charged to the best effort pool for every best effort container
+const defaultBestEffortCharge = 64 * 1024 * 1024
+
+// qosClass returns the QoS class of the given container resources,
+// a limit without a reservation is considered as guaranteed since docker reserves nothing less than the limit
+func qosClass(res container.Resources) string {
+	switch {
+	case res.Memory <= 0:
+		return QoSBestEffort
+	case res.MemoryReservation > 0 && res.MemoryReservation < res.Memory:
+		return QoSBurstable
+	default:
+		return QoSGuaranteed
+	}
+}
+
+// qosCost computes the cost of the given memory charge under the QoS model,
+// guaranteed containers are charged at their limit against both the soft and the burst capacity,
+// burstable containers at their reservation against the soft capacity and at their limit against the burst capacity,
+// and best effort containers are charged a fixed amount against the shared best effort pool
+func (f *basicAuthorizer) qosCost(res container.Resources, extra int64) containerCost {
+	switch qosClass(res) {
+	case QoSBestEffort:
+		charge := f.settings.BestEffortCharge
+		if charge == 0 {
+			charge = defaultBestEffortCharge
+		}
+		return containerCost{BestEffort: charge}
+	case QoSBurstable:
+		return containerCost{Memory: res.MemoryReservation + extra, Burst: res.Memory + extra}
+	default:
+		return containerCost{Memory: res.Memory + extra, Burst: res.Memory + extra}
+	}
+}
@@ -0,0 +1,175 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/go-units"
+)
+
+const (
+	// RecommendationOK indicates the declared limit matches the observed usage
+	RecommendationOK = "ok"
+	// RecommendationOverProvisioned indicates the declared limit is much larger than the observed usage
+	RecommendationOverProvisioned = "over-provisioned"
+	// RecommendationUnderProvisioned indicates the observed usage comes close to the declared limit
+	RecommendationUnderProvisioned = "under-provisioned"
+	// RecommendationUnlimited indicates the image runs without a declared limit
+	RecommendationUnlimited = "unlimited"
+)
+
+const (
+	maxImageSamples        = 500 // maxImageSamples bounds the usage samples kept per image
+	minRecommendSamples    = 10  // minRecommendSamples is the number of samples required before recommending a limit
+	recommendMarginPercent = 20  // recommendMarginPercent is added on top of the p95 usage to recommend a limit
+	overProvisionFactor    = 2   // overProvisionFactor is how many times the recommendation a limit must exceed to be over-provisioned
+	underProvisionPercent  = 90  // underProvisionPercent is the share of the limit the max usage must reach to be under-provisioned
+)
+
+// recommendation describes the observed memory usage of an image and the limit recommended for it
+type recommendation struct {
+	Image       string `json:"image"`
+	Samples     int    `json:"samples"`
+	P50         int64  `json:"p50"`
+	P95         int64  `json:"p95"`
+	Max         int64  `json:"max"`
+	Declared    int64  `json:"declared"`
+	Recommended int64  `json:"recommended"`
+	Status      string `json:"status"`
+}
+
+// imageUsage learns the memory usage distribution of every image from sampled container stats
+type imageUsage struct {
+	sync.Mutex
+	samples  map[string][]int64 // samples are the most recent usage samples by image
+	declared map[string]int64   // declared is the last declared memory limit by image
+}
+
+// newImageUsage creates an empty image usage history
+func newImageUsage() *imageUsage {
+	return &imageUsage{samples: make(map[string][]int64), declared: make(map[string]int64)}
+}
+
+// observe records a usage sample of a container of the given image
+func (u *imageUsage) observe(image string, usage int64) {
+	u.Lock()
+	defer u.Unlock()
+	samples := append(u.samples[image], usage)
+	if len(samples) > maxImageSamples {
+		samples = samples[len(samples)-maxImageSamples:]
+	}
+	u.samples[image] = samples
+}
+
+// declare records the memory limit a container of the given image declares
+func (u *imageUsage) declare(image string, limit int64) {
+	u.Lock()
+	defer u.Unlock()
+	u.declared[image] = limit
+}
+
+// recommend computes the recommendation of an image, and whether enough samples were observed to make one
+func (u *imageUsage) recommend(image string) (recommendation, bool) {
+	u.Lock()
+	samples := append([]int64(nil), u.samples[image]...)
+	declared := u.declared[image]
+	u.Unlock()
+
+	if len(samples) < minRecommendSamples {
+		return recommendation{}, false
+	}
+	sort.Sort(int64Slice(samples))
+	r := recommendation{
+		Image:    image,
+		Samples:  len(samples),
+		P50:      percentile(samples, 50),
+		P95:      percentile(samples, 95),
+		Max:      samples[len(samples)-1],
+		Declared: declared,
+	}
+	r.Recommended = r.P95 + r.P95*recommendMarginPercent/100
+	if r.Recommended < r.Max {
+		r.Recommended = r.Max
+	}
+
+	switch {
+	case declared == 0:
+		r.Status = RecommendationUnlimited
+	case r.Max*100 >= declared*underProvisionPercent:
+		r.Status = RecommendationUnderProvisioned
+	case declared > overProvisionFactor*r.Recommended:
+		r.Status = RecommendationOverProvisioned
+	default:
+		r.Status = RecommendationOK
+	}
+	return r, true
+}
+
+// recommendations returns the recommendation of every image with enough samples
+func (u *imageUsage) recommendations() []recommendation {
+	u.Lock()
+	images := make([]string, 0, len(u.samples))
+	for image := range u.samples {
+		images = append(images, image)
+	}
+	u.Unlock()
+
+	sort.Strings(images)
+	result := []recommendation{}
+	for _, image := range images {
+		if r, ok := u.recommend(image); ok {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// percentile returns the given percentile of sorted samples
+func percentile(sorted []int64, p int) int64 {
+	index := (len(sorted)*p+99)/100 - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+// int64Slice sorts int64 values in increasing order
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// withRecommendation appends the recommended limit of an image to a container create deny message when enabled
+func (f *basicAuthorizer) withRecommendation(msg, image string) string {
+	if !f.settings.RecommendInDeny || f.usage == nil || image == "" {
+		return msg
+	}
+	r, ok := f.usage.recommend(imageKey(image))
+	if !ok {
+		return msg
+	}
+	return fmt.Sprintf("%s (recommended limit for %s: -m %s, observed p95 %s)",
+		msg, r.Image, units.BytesSize(float64(r.Recommended)), units.BytesSize(float64(r.P95)))
+}
+
+// serveRecommendations answers the recommendations admin query, optionally filtered by image
+func (f *basicAuthorizer) serveRecommendations(w http.ResponseWriter, r *http.Request) {
+	result := []recommendation{}
+	if f.usage != nil {
+		if image := r.URL.Query().Get("image"); image != "" {
+			if recommendation, ok := f.usage.recommend(imageKey(image)); ok {
+				result = append(result, recommendation)
+			}
+		} else {
+			result = f.usage.recommendations()
+		}
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logrus.Errorf("Failed to write recommendations: %v", err)
+	}
+}
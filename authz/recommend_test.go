@@ -0,0 +1,32 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecommendations(t *testing.T) {
+
+	usage := newImageUsage()
+	usage.declare("nginx:latest", 1000)
+	usage.declare("jvm:latest", 100)
+	for i := int64(1); i <= 20; i++ {
+		usage.observe("nginx:latest", i*10)
+		usage.observe("jvm:latest", 80+i)
+	}
+	usage.observe("sparse:latest", 10)
+
+	_, ok := usage.recommend("sparse:latest")
+	assert.False(t, ok)
+
+	r, ok := usage.recommend("nginx:latest")
+	assert.True(t, ok)
+	assert.Equal(t, recommendation{Image: "nginx:latest", Samples: 20, P50: 100, P95: 190, Max: 200, Declared: 1000, Recommended: 228, Status: RecommendationOverProvisioned}, r)
+
+	r, ok = usage.recommend("jvm:latest")
+	assert.True(t, ok)
+	assert.Equal(t, RecommendationUnderProvisioned, r.Status)
+
+	assert.Len(t, usage.recommendations(), 2)
+}
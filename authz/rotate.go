@@ -0,0 +1,142 @@
+package authz
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rotatingFile is an append only file rotated once it would exceed a size, the rotated files are named
+// <path>.1 (the most recent) to <path>.<maxBackups>, with a .gz suffix when compressed
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	compress   bool
+	file       *os.File
+	size       int64
+}
+
+// openRotatingFile opens the file for appending, creating it and its folder if needed
+func openRotatingFile(path string, maxSize int64, maxBackups int, compress bool) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups, compress: compress}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the current file and records its size
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, stat.Size()
+	return nil
+}
+
+// Write appends to the file, rotating it first if the write would exceed the maximum size
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// backupName returns the name of the i-th rotated file
+func (r *rotatingFile) backupName(i int) string {
+	name := fmt.Sprintf("%s.%d", r.path, i)
+	if r.compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// rotate shifts the rotated files, dropping the oldest, and starts a new file
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(r.backupName(r.maxBackups))
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		os.Rename(r.backupName(i), r.backupName(i+1))
+	}
+	if r.maxBackups == 0 {
+		os.Remove(r.path)
+	} else if r.compress {
+		if err := gzipFile(r.path, r.backupName(1)); err != nil {
+			return err
+		}
+	} else if err := os.Rename(r.path, r.backupName(1)); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// gzipFile compresses the source file into the destination and removes the source
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := gzip.NewWriter(out)
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// AuditLogFiles returns the audit log file and its rotated files, compressed or not, oldest first
+func AuditLogFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	backups := make(map[int]string)
+	var indexes []int
+	for _, match := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(match, path+"."), ".gz")
+		i, err := strconv.Atoi(suffix)
+		if err != nil || i <= 0 {
+			continue
+		}
+		backups[i] = match
+		indexes = append(indexes, i)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+	var files []string
+	for _, i := range indexes {
+		files = append(files, backups[i])
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files, nil
+}
@@ -0,0 +1,135 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/AuthzMemory/core"
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/authorization"
+)
+
+const (
+	// UnknownRouteAllow allows the requests matching no known route
+	UnknownRouteAllow = "allow"
+	// UnknownRouteDeny denies the requests matching no known route
+	UnknownRouteDeny = "deny"
+	// UnknownRouteAudit allows the requests matching no known route and logs every one of them
+	UnknownRouteAudit = "audit"
+)
+
+// maxUnmatchedRoutes bounds the distinct unmatched routes counted, ids in unknown paths would grow the counts forever
+const maxUnmatchedRoutes = 1000
+
+// unmatchedOther is the key the unmatched requests are counted under once maxUnmatchedRoutes is reached
+const unmatchedOther = "other"
+
+// validateUnknownRoutePolicy validates the configured unknown route policy name
+func validateUnknownRoutePolicy(policy string) error {
+	switch policy {
+	case UnknownRouteAllow, UnknownRouteDeny, UnknownRouteAudit:
+		return nil
+	}
+	return fmt.Errorf("Invalid unknown route policy %q", policy)
+}
+
+// routePattern is an allowlisted method and path glob (e.g. "GET /distribution/*/json", "* /session")
+type routePattern struct {
+	method string // method is the request method, "*" for any
+	path   string // path is the glob the unversioned request path must match
+}
+
+// compileRoutePatterns validates the allowlisted route patterns
+func compileRoutePatterns(patterns []string) ([]routePattern, error) {
+	var compiled []routePattern
+	for _, pattern := range patterns {
+		parts := strings.Fields(pattern)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "/") {
+			return nil, fmt.Errorf("Invalid route pattern %q, expected METHOD /path", pattern)
+		}
+		if _, err := path.Match(parts[1], ""); err != nil {
+			return nil, fmt.Errorf("Invalid route pattern %q: %v", pattern, err)
+		}
+		compiled = append(compiled, routePattern{method: strings.ToUpper(parts[0]), path: parts[1]})
+	}
+	return compiled, nil
+}
+
+// matches returns whether the request method and unversioned path match the pattern
+func (p routePattern) matches(method, requestPath string) bool {
+	if p.method != "*" && p.method != method {
+		return false
+	}
+	ok, _ := path.Match(p.path, requestPath)
+	return ok
+}
+
+// unmatchedRoutes counts the requests matching no known route by method and path
+type unmatchedRoutes struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+// newUnmatchedRoutes creates empty unmatched route counts
+func newUnmatchedRoutes() *unmatchedRoutes {
+	return &unmatchedRoutes{counts: make(map[string]int)}
+}
+
+// add counts an unmatched request, and returns whether its route was seen for the first time
+func (u *unmatchedRoutes) add(method, requestPath string) bool {
+	u.Lock()
+	defer u.Unlock()
+	key := method + " " + requestPath
+	if _, ok := u.counts[key]; !ok && len(u.counts) >= maxUnmatchedRoutes {
+		key = unmatchedOther
+	}
+	u.counts[key]++
+	return u.counts[key] == 1
+}
+
+// snapshot returns a copy of the unmatched route counts
+func (u *unmatchedRoutes) snapshot() map[string]int {
+	u.Lock()
+	defer u.Unlock()
+	counts := make(map[string]int, len(u.counts))
+	for key, count := range u.counts {
+		counts[key] = count
+	}
+	return counts
+}
+
+// checkUnknownRoute applies the unknown route policy to a request matching no known route,
+// returning the deny response or nil to let the request through
+func (f *basicAuthorizer) checkUnknownRoute(authZReq *core.RequestContext) *authorization.Response {
+	method, requestPath := authZReq.RequestMethod, authZReq.Path
+	for _, pattern := range f.allowedRoutes {
+		if pattern.matches(method, requestPath) {
+			return nil
+		}
+	}
+
+	if f.unmatched.add(method, requestPath) {
+		logrus.Warnf("Request %s %s matches no known route, the route table may be missing a daemon endpoint", method, authZReq.RequestURI)
+	}
+	switch f.settings.UnknownRoutePolicy {
+	case UnknownRouteDeny:
+		return &authorization.Response{
+			Allow: false,
+			Msg:   fmt.Sprintf("Unrecognised docker API route %s %s is denied by default", method, requestPath),
+		}
+	case UnknownRouteAudit:
+		logrus.Infof("Allowing unrecognised request %s %s for tenant %q", method, authZReq.RequestURI, authZReq.Tenant)
+	}
+	return nil
+}
+
+// serveUnmatched writes the counts of requests matching no known route
+func (f *basicAuthorizer) serveUnmatched(w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(f.unmatched.snapshot()); err != nil {
+		logrus.Errorf("Failed to write unmatched routes: %v", err)
+	}
+}
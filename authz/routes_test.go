@@ -0,0 +1,48 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/AuthzMemory/core"
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnknownRoutes(t *testing.T) {
+
+	allowed, err := compileRoutePatterns([]string{"GET /distribution/*/json", "* /session"})
+	assert.NoError(t, err)
+	_, err = compileRoutePatterns([]string{"/session"})
+	assert.Error(t, err)
+
+	tests := []struct {
+		policy  string
+		method  string
+		url     string
+		allowed bool
+	}{
+		{UnknownRouteDeny, "GET", "/v1.30/distribution/busybox/json", true},
+		{UnknownRouteDeny, "POST", "/v1.30/session", true},
+		{UnknownRouteDeny, "POST", "/v1.30/distribution/busybox/json", false},
+		{UnknownRouteDeny, "GET", "/v1.25/secrets", false},
+		{UnknownRouteDeny, "GET", "/v1.24/containers/json", true},
+		{UnknownRouteAudit, "GET", "/v1.25/secrets", true},
+		{UnknownRouteAllow, "GET", "/v1.25/secrets", true},
+	}
+
+	for _, test := range tests {
+		f := connect(&basicAuthorizer{
+			settings:      &BasicAuthorizerSettings{UnknownRoutePolicy: test.policy},
+			allowedRoutes: allowed,
+			unmatched:     newUnmatchedRoutes(),
+			ledger:        newLedger(),
+		}, nil)
+		res := f.AuthZReq(core.NewRequestContext(&authorization.Request{RequestMethod: test.method, RequestURI: test.url}))
+		assert.Equal(t, test.allowed, res.Allow, "%s %s %s", test.policy, test.method, test.url)
+	}
+
+	unmatched := newUnmatchedRoutes()
+	assert.True(t, unmatched.add("GET", "/secrets"))
+	assert.False(t, unmatched.add("GET", "/secrets"))
+	assert.Equal(t, map[string]int{"GET /secrets": 2}, unmatched.snapshot())
+}
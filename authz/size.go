@@ -0,0 +1,34 @@
+package authz
+
+import (
+	"encoding/json"
+
+	"github.com/docker/go-units"
+)
+
+// MemorySize is an amount of memory in bytes, it is decoded from JSON numbers or human readable strings such as "512m"
+type MemorySize int64
+
+// UnmarshalJSON decodes a memory size from a number of bytes or a human readable string
+func (s *MemorySize) UnmarshalJSON(data []byte) error {
+	var bytes int64
+	if err := json.Unmarshal(data, &bytes); err == nil {
+		*s = MemorySize(bytes)
+		return nil
+	}
+	var human string
+	if err := json.Unmarshal(data, &human); err != nil {
+		return err
+	}
+	bytes, err := units.RAMInBytes(human)
+	if err != nil {
+		return err
+	}
+	*s = MemorySize(bytes)
+	return nil
+}
+
+// String returns the human readable memory size
+func (s MemorySize) String() string {
+	return units.BytesSize(float64(s))
+}
@@ -0,0 +1,176 @@
+package authz
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/container"
+	"golang.org/x/net/context"
+)
+
+const (
+	// AdmissionModelLimits admits containers against their declared limits
+	AdmissionModelLimits = "limits"
+	// AdmissionModelUsage admits containers against their observed usage peak plus headroom
+	AdmissionModelUsage = "usage"
+)
+
+const (
+	defaultStatsInterval      = 30 * time.Second       // defaultStatsInterval is the delay between two sampling rounds
+	defaultStatsDelay         = 200 * time.Millisecond // defaultStatsDelay is the minimal delay between two stats requests
+	defaultStatsMaxContainers = 100                    // defaultStatsMaxContainers bounds the containers sampled in a round
+	defaultStatsWindow        = 20                     // defaultStatsWindow is the number of samples the rolling peak is computed over
+	statsTimeout              = 5 * time.Second        // statsTimeout bounds a single stats request
+)
+
+// usageSampler keeps a rolling window of memory usage samples for every running container
+type usageSampler struct {
+	sync.Mutex
+	window  int                // window is the number of samples kept per container
+	samples map[string][]int64 // samples are the last observed usages by container id
+	offset  int                // offset is where the next round starts when a round is bounded
+}
+
+// newUsageSampler creates a sampler keeping the given number of samples per container
+func newUsageSampler(window int) *usageSampler {
+	if window <= 0 {
+		window = defaultStatsWindow
+	}
+	return &usageSampler{window: window, samples: make(map[string][]int64)}
+}
+
+// add records a usage sample for the given container
+func (s *usageSampler) add(id string, usage int64) {
+	s.Lock()
+	defer s.Unlock()
+	samples := append(s.samples[id], usage)
+	if len(samples) > s.window {
+		samples = samples[len(samples)-s.window:]
+	}
+	s.samples[id] = samples
+}
+
+// peak returns the highest usage in the rolling window of the given container
+func (s *usageSampler) peak(id string) (int64, bool) {
+	s.Lock()
+	defer s.Unlock()
+	samples, ok := s.samples[id]
+	if !ok || len(samples) == 0 {
+		return 0, false
+	}
+	var peak int64
+	for _, sample := range samples {
+		if sample > peak {
+			peak = sample
+		}
+	}
+	return peak, true
+}
+
+// forget drops the samples of a destroyed container
+func (s *usageSampler) forget(id string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.samples, id)
+}
+
+// admissionModel returns the name of the model containers are admitted against
+func (f *basicAuthorizer) admissionModel() string {
+	if f.settings.UsageAware {
+		return AdmissionModelUsage
+	}
+	return AdmissionModelLimits
+}
+
+// chargeOf computes the cost of a running container, in usage aware mode the memory charge is
+// max(reservation, observed peak + headroom), capped by the declared limit
+func (f *basicAuthorizer) chargeOf(id string, res container.Resources) containerCost {
+	cost := f.costOf(res)
+	if !f.settings.UsageAware || f.sampler == nil {
+		return cost
+	}
+	peak, ok := f.sampler.peak(id)
+	if !ok {
+		return cost
+	}
+	observed := peak + f.settings.UsageHeadroom
+	if res.MemoryReservation > observed {
+		observed = res.MemoryReservation
+	}
+	if cost.Memory == 0 || observed < cost.Memory {
+		cost.Memory = observed
+	}
+	return cost
+}
+
+// sampleUsage periodically samples the memory usage of running containers,
+// each round is bounded to a maximal number of containers and requests are spaced by a minimal delay
+func (f *basicAuthorizer) sampleUsage() {
+	interval := f.settings.StatsInterval
+	if interval == 0 {
+		interval = defaultStatsInterval
+	}
+	maxContainers := f.settings.StatsMaxContainers
+	if maxContainers == 0 {
+		maxContainers = defaultStatsMaxContainers
+	}
+
+	for {
+		containers, err := f.cli.ContainerList(context.Background(), types.ContainerListOptions{})
+		if err != nil {
+			countDockerError(dockerContainerList, err)
+			logrus.Errorf("Failed to list containers for sampling: %v", err)
+			time.Sleep(interval)
+			continue
+		}
+
+		f.sampler.Lock()
+		offset := f.sampler.offset
+		if offset >= len(containers) {
+			offset = 0
+		}
+		f.sampler.offset = offset + maxContainers
+		f.sampler.Unlock()
+
+		for i := 0; i < maxContainers && i < len(containers); i++ {
+			c := containers[(offset+i)%len(containers)]
+			usage, err := f.containerUsage(c.ID)
+			if err != nil {
+				logrus.Debugf("Failed to sample container %s: %v", c.ID, err)
+			} else {
+				f.sampler.add(c.ID, usage)
+				if f.usage != nil {
+					f.usage.observe(imageKey(c.Image), usage)
+				}
+			}
+			time.Sleep(defaultStatsDelay)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// containerUsage returns the memory used by a container, excluding the page cache
+func (f *basicAuthorizer) containerUsage(id string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	body, err := f.cli.ContainerStats(ctx, id, false)
+	if err != nil {
+		countDockerError(dockerContainerStats, err)
+		return 0, err
+	}
+	defer body.Close()
+
+	var stats types.StatsJSON
+	if err := json.NewDecoder(body).Decode(&stats); err != nil {
+		return 0, err
+	}
+	usage := stats.MemoryStats.Usage
+	if cache, ok := stats.MemoryStats.Stats["cache"]; ok && cache < usage {
+		usage -= cache
+	}
+	return int64(usage), nil
+}
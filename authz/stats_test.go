@@ -0,0 +1,33 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/docker/engine-api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageCharge(t *testing.T) {
+
+	f := &basicAuthorizer{
+		settings: &BasicAuthorizerSettings{MemoryModel: MemoryModelLimit, UsageAware: true, UsageHeadroom: 10},
+		sampler:  newUsageSampler(2),
+	}
+
+	// Without samples the declared limit is charged
+	assert.Equal(t, int64(1000), f.chargeOf("id", container.Resources{Memory: 1000}).Memory)
+
+	f.sampler.add("id", 300)
+	f.sampler.add("id", 100)
+	assert.Equal(t, int64(310), f.chargeOf("id", container.Resources{Memory: 1000}).Memory)
+	assert.Equal(t, int64(500), f.chargeOf("id", container.Resources{Memory: 1000, MemoryReservation: 500}).Memory)
+	assert.Equal(t, int64(200), f.chargeOf("id", container.Resources{Memory: 200}).Memory)
+
+	// The oldest sample leaves the rolling window
+	f.sampler.add("id", 50)
+	assert.Equal(t, int64(110), f.chargeOf("id", container.Resources{Memory: 1000}).Memory)
+	assert.Equal(t, int64(110), f.chargeOf("id", container.Resources{}).Memory)
+
+	f.sampler.forget("id")
+	assert.Equal(t, int64(1000), f.chargeOf("id", container.Resources{Memory: 1000}).Memory)
+}
@@ -0,0 +1,167 @@
+package authz
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AuthzMemory/core"
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/container"
+	"golang.org/x/net/context"
+)
+
+const (
+	// SweepActionLog only logs the containers violating the policy
+	SweepActionLog = "log"
+	// SweepActionPause pauses the containers violating the policy
+	SweepActionPause = "pause"
+	// SweepActionStop stops the containers violating the policy
+	SweepActionStop = "stop"
+	// SweepActionUpdate applies the default memory limit to the containers violating the policy
+	SweepActionUpdate = "update"
+)
+
+// defaultSweepMaxActions bounds the actions taken by a single sweep
+const defaultSweepMaxActions = 10
+
+// validateSweepAction validates the configured sweep action name
+func validateSweepAction(action string) error {
+	switch action {
+	case SweepActionLog, SweepActionPause, SweepActionStop, SweepActionUpdate:
+		return nil
+	}
+	return fmt.Errorf("Unknown sweep action %q", action)
+}
+
+// sweep periodically evaluates every running container against the memory policy,
+// catching the containers the plugin could not authorize when they were created
+func (f *basicAuthorizer) sweep() {
+	for {
+		time.Sleep(f.settings.SweepInterval)
+		f.sweepOnce()
+	}
+}
+
+// sweepOnce evaluates the running containers against the memory checks (resources, image rules and OOM history)
+// and takes the sweep action on the violating ones, it returns the number of actions taken or that would be
+// taken in dry run. The policy rules are not evaluated, they apply to API requests and a running container
+// has no request to evaluate them on
+func (f *basicAuthorizer) sweepOnce() int {
+	containers, err := f.cli.ContainerList(context.Background(), types.ContainerListOptions{})
+	if err != nil {
+		countDockerError(dockerContainerList, err)
+		logrus.Errorf("Failed to list containers for sweeping: %v", err)
+		return 0
+	}
+
+	maxActions := f.settings.SweepMaxActions
+	if maxActions == 0 {
+		maxActions = defaultSweepMaxActions
+	}
+	actions := 0
+	for _, c := range containers {
+		cJSON, err := f.cli.ContainerInspect(context.Background(), c.ID)
+		countDockerError(dockerContainerInspect, err)
+		if err != nil || cJSON.ContainerJSONBase == nil || cJSON.HostConfig == nil || cJSON.Config == nil {
+			continue
+		}
+		msg := f.checkContainer(cJSON.Config.Image, cJSON.HostConfig.Resources)
+		if msg == "" {
+			continue
+		}
+		if f.settings.SweepAction == SweepActionLog {
+			logrus.Warnf("Container %s violates the memory policy: %s", c.ID, msg)
+			continue
+		}
+		if f.settings.SweepAction == SweepActionPause && cJSON.State != nil && cJSON.State.Paused {
+			// paused by an earlier sweep, it must not use up the actions of the newly violating containers
+			logrus.Debugf("Container %s violates the memory policy: %s, already paused", c.ID, msg)
+			continue
+		}
+		if actions >= maxActions {
+			logrus.Warnf("Container %s violates the memory policy: %s, skipped since the sweep reached %d actions", c.ID, msg, maxActions)
+			continue
+		}
+		actions++
+		if f.settings.SweepDryRun {
+			logrus.Warnf("Container %s violates the memory policy: %s, would %s it (dry run)", c.ID, msg, f.settings.SweepAction)
+			continue
+		}
+		if err := f.sweepContainer(cJSON, msg); err != nil {
+			logrus.Errorf("Failed to %s container %s violating the memory policy: %v", f.settings.SweepAction, c.ID, err)
+		}
+	}
+	return actions
+}
+
+// sweepContainer takes the configured action on a container violating the memory policy
+func (f *basicAuthorizer) sweepContainer(cJSON types.ContainerJSON, msg string) error {
+	ctx := context.Background()
+	switch f.settings.SweepAction {
+	case SweepActionPause:
+		if err := f.cli.ContainerPause(ctx, cJSON.ID); err != nil {
+			countDockerError(dockerContainerPause, err)
+			return err
+		}
+	case SweepActionStop:
+		if err := f.cli.ContainerStop(ctx, cJSON.ID, nil); err != nil {
+			countDockerError(dockerContainerStop, err)
+			return err
+		}
+	case SweepActionUpdate:
+		tenant := core.ResourceTenant(cJSON.ID)
+		limit, source := f.updateLimit(cJSON, tenant)
+		if limit == 0 {
+			logrus.Warnf("Container %s violates the memory policy: %s, no memory limit to apply fixes it", cJSON.ID, msg)
+			return nil
+		}
+		update := container.UpdateConfig{Resources: container.Resources{Memory: limit}}
+		if _, err := f.cli.ContainerUpdate(ctx, cJSON.ID, update); err != nil {
+			countDockerError(dockerContainerUpdate, err)
+			return err
+		}
+		resources := cJSON.HostConfig.Resources
+		resources.Memory = limit
+		entry := f.parentEntry(resources.CgroupParent, f.costOf(resources))
+		entry.Tenant = tenant
+		f.ledger.commit(cJSON.ID, entry)
+		msg = fmt.Sprintf("%s, applied %s from %s", msg, MemorySize(limit), source)
+	}
+	logrus.Warnf("Container %s violates the memory policy: %s, %s action taken", cJSON.ID, msg, f.settings.SweepAction)
+	return nil
+}
+
+// updateLimit returns the memory limit fixing the violation of a running container and where it comes from:
+// its current limit, or the default one when it has none, clamped to the bounds of the matching image rule.
+// It returns zero when no such limit complies with the memory policy
+func (f *basicAuthorizer) updateLimit(cJSON types.ContainerJSON, tenant string) (int64, string) {
+	image := cJSON.Config.Image
+	limit, source := cJSON.HostConfig.Memory, "current limit"
+	if limit == 0 {
+		limit, source = f.defaultLimit(image, tenant)
+	}
+	rules := f.imageRules()
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.matches(image) {
+			continue
+		}
+		if rule.Min > 0 && limit < int64(rule.Min) {
+			limit, source = int64(rule.Min), "image rule "+rule.Image
+		}
+		if rule.Max > 0 && (limit == 0 || limit > int64(rule.Max)) {
+			limit, source = int64(rule.Max), "image rule "+rule.Image
+		}
+		break
+	}
+	if limit == 0 || limit == cJSON.HostConfig.Memory {
+		return 0, ""
+	}
+	resources := cJSON.HostConfig.Resources
+	resources.Memory = limit
+	if f.checkContainer(image, resources) != "" {
+		return 0, ""
+	}
+	return limit, source
+}
@@ -0,0 +1,116 @@
+package authz
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/docker/engine-api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSweep(t *testing.T) {
+
+	inspect := func(id string, paused bool, memory string) string {
+		state := `"Running":true,"Paused":false`
+		if paused {
+			state = `"Running":true,"Paused":true`
+		}
+		return `{"Id":"` + id + `","State":{` + state + `},"HostConfig":{"Memory":` + memory + `},"Config":{"Image":"busybox"}}`
+	}
+	// b was paused by an earlier sweep, c complies with the busybox rule
+	daemon := newFakeDaemon(t, map[string]string{
+		"GET /containers/json":     `[{"Id":"b","Image":"busybox"},{"Id":"a","Image":"busybox"},{"Id":"c","Image":"busybox"},{"Id":"d","Image":"busybox"}]`,
+		"GET /containers/a/json":   inspect("a", false, "0"),
+		"GET /containers/b/json":   inspect("b", true, "0"),
+		"GET /containers/c/json":   inspect("c", false, "134217728"),
+		"GET /containers/d/json":   inspect("d", false, "0"),
+		"POST /containers/a/pause": ``,
+		"POST /containers/d/pause": ``,
+		"POST /containers/b/stop":  ``,
+		"POST /containers/a/stop":  ``,
+	})
+	defer daemon.close()
+
+	tests := []struct {
+		action     string
+		dryRun     bool
+		maxActions int
+		actions    int
+		calls      []string
+	}{
+		{SweepActionLog, false, 1, 0, nil},
+		{SweepActionPause, false, 1, 1, []string{"POST /containers/a/pause"}},
+		{SweepActionPause, false, 5, 2, []string{"POST /containers/a/pause", "POST /containers/d/pause"}},
+		{SweepActionPause, true, 5, 2, nil},
+		{SweepActionPause, true, 1, 1, nil},
+		{SweepActionStop, false, 2, 2, []string{"POST /containers/b/stop", "POST /containers/a/stop"}},
+	}
+
+	for _, test := range tests {
+		f := connect(&basicAuthorizer{
+			settings: &BasicAuthorizerSettings{
+				ImageRules:      []ImageRule{{Image: "busybox", Min: 64 << 20}},
+				SweepAction:     test.action,
+				SweepDryRun:     test.dryRun,
+				SweepMaxActions: test.maxActions,
+			},
+			ooms: newOOMTracker(),
+		}, daemon)
+		assert.NoError(t, compileImageRules(f.settings.ImageRules))
+		calls := len(daemon.received())
+		assert.Equal(t, test.actions, f.sweepOnce(), "%s dry run %v max %d", test.action, test.dryRun, test.maxActions)
+
+		var actions []string
+		for _, call := range daemon.received()[calls:] {
+			if strings.HasPrefix(call, "POST ") {
+				actions = append(actions, call)
+			}
+		}
+		assert.Equal(t, test.calls, actions, "%s dry run %v max %d", test.action, test.dryRun, test.maxActions)
+	}
+}
+
+func TestSweepUpdate(t *testing.T) {
+
+	inspect := func(id, memory, swap string) string {
+		return `{"Id":"` + id + `","State":{"Running":true},"HostConfig":{"Memory":` + memory + `,"MemorySwap":` + swap + `},"Config":{"Image":"busybox"}}`
+	}
+	// a has no limit, b is above the rule maximum, c is below the minimum and its swap forbids raising it
+	daemon := newFakeDaemon(t, map[string]string{
+		"GET /containers/json":      `[{"Id":"a","Image":"busybox"},{"Id":"b","Image":"busybox"},{"Id":"c","Image":"busybox"}]`,
+		"GET /containers/a/json":    inspect("a", "0", "0"),
+		"GET /containers/b/json":    inspect("b", "1073741824", "0"),
+		"GET /containers/c/json":    inspect("c", "33554432", "50331648"),
+		"POST /containers/a/update": `{}`,
+		"POST /containers/b/update": `{}`,
+	})
+	defer daemon.close()
+
+	f := connect(&basicAuthorizer{
+		settings: &BasicAuthorizerSettings{
+			MemoryModel:     MemoryModelLimit,
+			ImageRules:      []ImageRule{{Image: "busybox", Min: 64 << 20, Max: 512 << 20}},
+			SweepAction:     SweepActionUpdate,
+			SweepMaxActions: 5,
+		},
+		ooms:   newOOMTracker(),
+		ledger: newLedger(),
+	}, daemon)
+	assert.NoError(t, compileImageRules(f.settings.ImageRules))
+	f.ledger.commit("b", ledgerEntry{Cost: containerCost{Memory: 1 << 30}})
+
+	assert.Equal(t, 3, f.sweepOnce())
+	updates := make(map[string]int64)
+	for i, call := range daemon.received() {
+		if strings.HasPrefix(call, "POST ") {
+			var update container.UpdateConfig
+			assert.NoError(t, json.Unmarshal([]byte(daemon.bodies[i]), &update))
+			updates[call] = update.Memory
+		}
+	}
+	assert.Equal(t, map[string]int64{"POST /containers/a/update": 64 << 20, "POST /containers/b/update": 512 << 20}, updates)
+
+	host, _ := f.ledger.memoryUsage()
+	assert.Equal(t, int64(64<<20+512<<20), host.Committed)
+}
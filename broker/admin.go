@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AuthzMemory/core"
+	"github.com/codegangsta/cli"
+	"github.com/docker/go-units"
+)
+
+const imageFlag = "image"
+
+// recommendation mirrors the recommendations returned by the plugin admin endpoint
+type recommendation struct {
+	Image       string `json:"image"`
+	Samples     int    `json:"samples"`
+	P50         int64  `json:"p50"`
+	P95         int64  `json:"p95"`
+	Max         int64  `json:"max"`
+	Declared    int64  `json:"declared"`
+	Recommended int64  `json:"recommended"`
+	Status      string `json:"status"`
+}
+
+// wouldDenyReport mirrors the would-be denials report returned by the plugin admin endpoint
+type wouldDenyReport struct {
+	Mode     string         `json:"mode"`
+	Since    time.Time      `json:"since"`
+	Total    int            `json:"total"`
+	ByTenant map[string]int `json:"by_tenant"`
+	ByRule   map[string]int `json:"by_rule"`
+	Entries  []struct {
+		Tenant      string    `json:"tenant"`
+		Rule        string    `json:"rule"`
+		Count       int       `json:"count"`
+		LastSeen    time.Time `json:"last_seen"`
+		LastMessage string    `json:"last_message"`
+	} `json:"entries"`
+}
+
+// adminGet queries an admin endpoint of the running plugin over its unix socket and decodes the JSON answer
+func adminGet(name string, query url.Values, out interface{}) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.Dial("unix", core.PluginSocketPath)
+			},
+		},
+	}
+	u := url.URL{Scheme: "http", Host: "plugin", Path: fmt.Sprintf("%s/%s", core.AdminPathPrefix, name), RawQuery: query.Encode()}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Admin query %q failed with status %s", name, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// recommendationsCommand prints the memory limit recommendations learned by the running plugin
+var recommendationsCommand = cli.Command{
+	Name:  "recommendations",
+	Usage: "Show memory limit recommendations per image",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  imageFlag,
+			Usage: "Only show the recommendation of the given image",
+		},
+		cli.BoolFlag{
+			Name:  jsonFlag,
+			Usage: "Print the recommendations as JSON",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		query := url.Values{}
+		if image := c.String(imageFlag); image != "" {
+			query.Set("image", image)
+		}
+		var recommendations []recommendation
+		if err := adminGet("recommendations", query, &recommendations); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		if c.Bool(jsonFlag) {
+			return json.NewEncoder(os.Stdout).Encode(recommendations)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "IMAGE\tSAMPLES\tP50\tP95\tMAX\tDECLARED\tRECOMMENDED\tSTATUS")
+		for _, r := range recommendations {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Image, r.Samples,
+				units.BytesSize(float64(r.P50)), units.BytesSize(float64(r.P95)), units.BytesSize(float64(r.Max)),
+				units.BytesSize(float64(r.Declared)), units.BytesSize(float64(r.Recommended)), r.Status)
+		}
+		return w.Flush()
+	},
+}
+
+// wouldDenyCommand prints the requests the running plugin allowed in audit mode but would have denied
+var wouldDenyCommand = cli.Command{
+	Name:  "would-deny",
+	Usage: "Show the requests allowed in audit mode that would have been denied, by tenant and rule",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  jsonFlag,
+			Usage: "Print the report as JSON",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		var report wouldDenyReport
+		if err := adminGet("would-deny", url.Values{}, &report); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		if c.Bool(jsonFlag) {
+			return json.NewEncoder(os.Stdout).Encode(report)
+		}
+		fmt.Printf("Enforcement mode: %s, %d would-be denials since %s\n\n", report.Mode, report.Total, report.Since.Format(time.RFC3339))
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TENANT\tRULE\tCOUNT\tLAST SEEN\tLAST MESSAGE")
+		for _, e := range report.Entries {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", e.Tenant, e.Rule, e.Count, e.LastSeen.Format(time.RFC3339), e.LastMessage)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "TENANT\tTOTAL")
+		for _, tenant := range sortedKeys(report.ByTenant) {
+			fmt.Fprintf(w, "%s\t%d\n", tenant, report.ByTenant[tenant])
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "RULE\tTOTAL")
+		for _, rule := range sortedKeys(report.ByRule) {
+			fmt.Fprintf(w, "%s\t%d\n", rule, report.ByRule[rule])
+		}
+		return w.Flush()
+	},
+}
+
+// sortedKeys returns the keys of the counts in alphabetical order
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AuthzMemory/authz"
+	"github.com/codegangsta/cli"
+)
+
+const (
+	keyFlag      = "key"
+	sinceFlag    = "since"
+	untilFlag    = "until"
+	userFlag     = "user"
+	tenantFlag   = "tenant"
+	actionFlag   = "action"
+	resourceFlag = "resource"
+	decisionFlag = "decision"
+)
+
+// auditTimeLayouts are the absolute time formats of the search time range, in the local time zone
+// unless they carry one, times of day are relative to the current day
+var auditTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "15:04:05", "15:04"}
+
+// auditCommand groups the audit log subcommands
+var auditCommand = cli.Command{
+	Name:  "audit",
+	Usage: "Inspect the audit log",
+	Subcommands: []cli.Command{
+		auditVerifyCommand,
+		auditSearchCommand,
+	},
+}
+
+// auditLogFiles returns the files given as arguments, or the audit log and its rotated files oldest first
+func auditLogFiles(c *cli.Context) ([]string, error) {
+	if c.NArg() > 0 {
+		return c.Args(), nil
+	}
+	files, err := authz.AuditLogFiles(c.GlobalString(auditLogPathFlag))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No audit log file found at %s", c.GlobalString(auditLogPathFlag))
+	}
+	return files, nil
+}
+
+// auditVerifyCommand checks the hash chain and the checkpoint signatures of audit log files
+var auditVerifyCommand = cli.Command{
+	Name:      "verify",
+	Usage:     "Verify the audit log was not modified, reordered or truncated",
+	ArgsUsage: "[file...] (defaults to the audit log and its rotated files, oldest first)",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  keyFlag,
+			Usage: "Defines the public or private key verifying the checkpoint signatures, defaults to the audit key .pub file",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		files, err := auditLogFiles(c)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		keyFile := c.String(keyFlag)
+		if keyFile == "" {
+			keyFile = c.GlobalString(auditKeyFlag) + ".pub"
+		}
+		publicKey, err := authz.LoadAuditPublicKey(keyFile)
+		if err != nil {
+			if c.IsSet(keyFlag) || !os.IsNotExist(err) {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			fmt.Printf("No key found at %s, checkpoint signatures are not verified\n", keyFile)
+		}
+
+		verifier := authz.NewAuditVerifier(publicKey)
+		for _, file := range files {
+			if err := verifier.Verify(file); err != nil {
+				return cli.NewExitError(fmt.Sprintf("Audit log is broken: %v", err), 1)
+			}
+		}
+		fmt.Printf("Verified %d records and %d checkpoints in %d files\n", verifier.Records, verifier.Checkpoints, len(files))
+		if verifier.Checkpoints > 0 {
+			fmt.Printf("Last checkpoint at %s, %d records after it\n", verifier.LastSigned.Format(time.RFC3339), verifier.Unsigned)
+		}
+		if verifier.Restarts > 0 {
+			fmt.Printf("The chain started over %d times with a signed checkpoint\n", verifier.Restarts)
+		}
+		return nil
+	},
+}
+
+// parseAuditTime parses a time of the search time range, either absolute or a duration before now (e.g. 2h)
+func parseAuditTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range auditTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, now.Location())
+		if err != nil {
+			continue
+		}
+		if !strings.HasPrefix(layout, "2006") {
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, now.Location())
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid time %q, expected a duration (2h), a date (2006-01-02 15:04) or a time of day (15:04)", value)
+}
+
+// auditSearchCommand prints the audit records matching filters
+var auditSearchCommand = cli.Command{
+	Name:      "search",
+	Usage:     "Search the audit log",
+	ArgsUsage: "[file...] (defaults to the audit log and its rotated files, oldest first)",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  sinceFlag,
+			Usage: "Only show records after a time (2006-01-02 15:04, 15:04) or a duration ago (2h)",
+		},
+		cli.StringFlag{
+			Name:  untilFlag,
+			Usage: "Only show records before a time (2006-01-02 15:04, 15:04) or a duration ago (2h)",
+		},
+		cli.StringFlag{
+			Name:  userFlag,
+			Usage: "Only show the records of a user",
+		},
+		cli.StringFlag{
+			Name:  tenantFlag,
+			Usage: "Only show the records of a tenant",
+		},
+		cli.StringSliceFlag{
+			Name:  actionFlag,
+			Usage: "Only show the records of a docker action or action pattern (e.g. container_create, service_*)",
+		},
+		cli.StringFlag{
+			Name:  resourceFlag,
+			Usage: "Only show the records of a resource id or id prefix",
+		},
+		cli.StringFlag{
+			Name:  decisionFlag,
+			Usage: "Only show the records with a decision (allow, deny, error, abstain)",
+		},
+		cli.BoolFlag{
+			Name:  jsonFlag,
+			Usage: "Print the records as JSON lines",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		now := time.Now()
+		since, err := parseAuditTime(c.String(sinceFlag), now)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		until, err := parseAuditTime(c.String(untilFlag), now)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		query := &authz.AuditQuery{
+			Since:      since,
+			Until:      until,
+			User:       c.String(userFlag),
+			Tenant:     c.String(tenantFlag),
+			Actions:    c.StringSlice(actionFlag),
+			ResourceID: c.String(resourceFlag),
+			Decision:   c.String(decisionFlag),
+		}
+		if err := query.Validate(); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		files, err := auditLogFiles(c)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		records, err := authz.SearchAuditLog(files, query)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		if c.Bool(jsonFlag) {
+			encoder := json.NewEncoder(os.Stdout)
+			for _, record := range records {
+				if err := encoder.Encode(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tPHASE\tUSER\tTENANT\tACTION\tRESOURCE\tDECISION\tMESSAGE")
+		for _, r := range records {
+			resource := r.ResourceID
+			if len(resource) > 12 {
+				resource = resource[:12]
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Timestamp.Local().Format("2006-01-02 15:04:05"), r.Phase,
+				r.User, r.Tenant, r.Action, resource, r.Decision, r.Message)
+		}
+		return w.Flush()
+	},
+}
@@ -4,20 +4,76 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/Sirupsen/logrus"
-	"github.com/codegangsta/cli"
 	"github.com/AuthzMemory/authz"
 	"github.com/AuthzMemory/core"
+	"github.com/AuthzMemory/metrics"
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/docker/go-units"
 )
 
 const (
-	debugFlag      = "debug"
-	authorizerFlag = "authz-handler"
+	debugFlag             = "debug"
+	authorizerFlag        = "authz-handler"
+	chainModeFlag         = "authz-chain-mode"
+	memoryModelFlag       = "memory-model"
+	countKernelMemoryFlag = "count-kernel-memory"
+	qosFlag               = "qos"
+	burstCapacityFlag     = "burst-capacity"
+	bestEffortPoolFlag    = "best-effort-pool"
+	bestEffortChargeFlag  = "best-effort-charge"
+	usageAwareFlag        = "usage-aware"
+	usageHeadroomFlag     = "usage-headroom"
+	statsIntervalFlag     = "stats-interval"
+	statsMaxFlag          = "stats-max-containers"
+	statsWindowFlag       = "stats-window"
+	meminfoPathFlag       = "meminfo-path"
+	pressurePathFlag      = "pressure-path"
+	pressureWindowFlag    = "pressure-window"
+	pressureSomeFlag      = "pressure-some-threshold"
+	pressureFullFlag      = "pressure-full-threshold"
+	minMemAvailableFlag   = "min-mem-available"
+	memoryCapacityFlag    = "memory-capacity"
+	cgroupAwareFlag       = "cgroup-aware"
+	cgroupRootFlag        = "cgroup-root"
+	cgroupPathFlag        = "cgroup-path"
+	oomRepeatCountFlag    = "oom-repeat-count"
+	oomWindowFlag         = "oom-window"
+	recommendationsFlag   = "recommendations"
+	recommendInDenyFlag   = "recommend-in-deny"
+	jsonFlag              = "json"
+	imageRulesFlag        = "image-rules"
+	enforceDefaultFlag    = "enforce-default-limit"
+	defaultLimitFlag      = "default-memory-limit"
+	tenantDefaultFlag     = "tenant-default-limit"
+	sweepIntervalFlag     = "sweep-interval"
+	sweepActionFlag       = "sweep-action"
+	sweepDryRunFlag       = "sweep-dry-run"
+	sweepMaxActionsFlag   = "sweep-max-actions"
+	bodyUnavailableFlag   = "body-unavailable"
+	unknownRoutesFlag     = "unknown-routes"
+	unknownRouteAllowFlag = "unknown-route-allow"
+	policyFileFlag        = "policy-file"
+	policyPollFlag        = "policy-poll-interval"
+	enforcementFlag       = "enforcement"
+	auditHookFlag         = "audit-hook"
+	auditLogPathFlag      = "audit-log-path"
+	auditMaxSizeFlag      = "audit-max-size"
+	auditMaxBackupsFlag   = "audit-max-backups"
+	auditCompressFlag     = "audit-compress"
+	auditBodyFlag         = "audit-body-redaction"
+	auditKeyFlag          = "audit-key"
+	auditCheckpointFlag   = "audit-checkpoint-interval"
+	metricsListenFlag     = "metrics-listen"
 )
 
 const (
 	authorizerBasic = "basic"
+	// auditSuffix marks the authorizers of the chain only logging their decisions (e.g. "basic:audit")
+	auditSuffix = ":audit"
 )
 
 func main() {
@@ -31,17 +87,45 @@ func main() {
 
 		// initLogger(c.GlobalBool(debugFlag))
 
-		var authZHandler core.Authorizer
-
-		switch c.GlobalString(authorizerFlag) {
-		case authorizerBasic:
-			authZHandler = authz.NewBasicAuthZAuthorizer(&authz.BasicAuthorizerSettings{})
-		default:
-			panic(fmt.Sprintf("Unkwon authz hander %q", c.GlobalString(authorizerFlag)))
+		var members []core.ChainMember
+		configured := make(map[string]bool)
+		for _, handler := range strings.Split(c.GlobalString(authorizerFlag), ",") {
+			name, audit := strings.TrimSpace(handler), false
+			if strings.HasSuffix(name, auditSuffix) {
+				name, audit = strings.TrimSuffix(name, auditSuffix), true
+			}
+			// the instances of a handler would each keep their own ledger of the same host
+			if configured[name] {
+				panic(fmt.Sprintf("Authz handler %q is configured more than once", name))
+			}
+			configured[name] = true
+			members = append(members, core.ChainMember{Name: name, Authorizer: newAuthorizer(c, name), Audit: audit})
 		}
+		chain, err := core.NewChain(c.GlobalString(chainModeFlag), members)
+		if err != nil {
+			panic(err)
+		}
+
+		srv := core.NewAuthZSrv(chain)
+		if c.GlobalString(auditHookFlag) != authz.AuditHookNone {
+			srv.SetAuditor(authz.NewBasicAuditor(&authz.BasicAuditorSettings{
+				LogHook:       c.GlobalString(auditHookFlag),
+				LogPath:       c.GlobalString(auditLogPathFlag),
+				MaxSize:       sizeFlag(c, auditMaxSizeFlag),
+				MaxBackups:    c.GlobalInt(auditMaxBackupsFlag),
+				Compress:      c.GlobalBool(auditCompressFlag),
+				BodyRedaction: c.GlobalString(auditBodyFlag),
 
-		srv := core.NewAuthZSrv(authZHandler)
-		err := srv.Start()
+				KeyPath:            c.GlobalString(auditKeyFlag),
+				CheckpointInterval: c.GlobalDuration(auditCheckpointFlag),
+			}))
+		}
+		if addr := c.GlobalString(metricsListenFlag); addr != "" {
+			if err := metrics.Serve(addr); err != nil {
+				panic(err)
+			}
+		}
+		err = srv.Start()
 
 		if err != nil {
 			panic(err)
@@ -60,13 +144,436 @@ func main() {
 			Name:   authorizerFlag,
 			Value:  authorizerBasic,
 			EnvVar: "AUTHORIZER",
-			Usage:  "Defines the authz handler type",
+			Usage:  "Defines the comma separated authz handler chain, each handler at most once, a handler suffixed with :audit only logs its decisions",
+		},
+
+		cli.StringFlag{
+			Name:   chainModeFlag,
+			Value:  core.ChainAllMustAllow,
+			EnvVar: "AUTHORIZER_CHAIN_MODE",
+			Usage:  "Defines how the decisions of the authz handler chain combine (all, first)",
+		},
+
+		cli.StringFlag{
+			Name:   memoryModelFlag,
+			Value:  authz.MemoryModelLimit,
+			EnvVar: "MEMORY_MODEL",
+			Usage:  "Defines how the cost of a container is computed (memory, memory+swap)",
+		},
+
+		cli.BoolFlag{
+			Name:   countKernelMemoryFlag,
+			Usage:  "Count the kernel memory limit of containers on top of their memory limit",
+			EnvVar: "COUNT_KERNEL_MEMORY",
+		},
+
+		cli.BoolFlag{
+			Name:   qosFlag,
+			Usage:  "Admit containers by QoS class (guaranteed, burstable, best-effort)",
+			EnvVar: "QOS",
+		},
+
+		cli.StringFlag{
+			Name:   burstCapacityFlag,
+			EnvVar: "BURST_CAPACITY",
+			Usage:  "Defines the capacity for the memory limits of QoS containers (e.g. 64g), defaults to the host memory",
+		},
+
+		cli.StringFlag{
+			Name:   bestEffortPoolFlag,
+			EnvVar: "BEST_EFFORT_POOL",
+			Usage:  "Defines the memory pool shared by best effort containers (e.g. 2g)",
+		},
+
+		cli.StringFlag{
+			Name:   bestEffortChargeFlag,
+			EnvVar: "BEST_EFFORT_CHARGE",
+			Usage:  "Defines the amount charged to the best effort pool for every best effort container (e.g. 64m)",
+		},
+
+		cli.BoolFlag{
+			Name:   usageAwareFlag,
+			Usage:  "Admit containers against their observed memory usage instead of their limits",
+			EnvVar: "USAGE_AWARE",
+		},
+
+		cli.StringFlag{
+			Name:   usageHeadroomFlag,
+			Value:  "256m",
+			EnvVar: "USAGE_HEADROOM",
+			Usage:  "Defines the headroom added to the observed usage peak of every container",
+		},
+
+		cli.DurationFlag{
+			Name:   statsIntervalFlag,
+			Value:  30 * time.Second,
+			EnvVar: "STATS_INTERVAL",
+			Usage:  "Defines the delay between two usage sampling rounds",
+		},
+
+		cli.IntFlag{
+			Name:   statsMaxFlag,
+			Value:  100,
+			EnvVar: "STATS_MAX_CONTAINERS",
+			Usage:  "Defines the maximal number of containers sampled in a round",
+		},
+
+		cli.IntFlag{
+			Name:   statsWindowFlag,
+			Value:  20,
+			EnvVar: "STATS_WINDOW",
+			Usage:  "Defines the number of samples the usage peak is computed over",
+		},
+
+		cli.StringFlag{
+			Name:   meminfoPathFlag,
+			Value:  "/proc/meminfo",
+			EnvVar: "MEMINFO_PATH",
+			Usage:  "Defines the host memory information file",
+		},
+
+		cli.StringFlag{
+			Name:   pressurePathFlag,
+			Value:  "/proc/pressure/memory",
+			EnvVar: "PRESSURE_PATH",
+			Usage:  "Defines the host memory pressure stall information file",
+		},
+
+		cli.StringFlag{
+			Name:   pressureWindowFlag,
+			Value:  "avg10",
+			EnvVar: "PRESSURE_WINDOW",
+			Usage:  "Defines the pressure average compared with the thresholds (avg10, avg60, avg300)",
+		},
+
+		cli.Float64Flag{
+			Name:   pressureSomeFlag,
+			EnvVar: "PRESSURE_SOME_THRESHOLD",
+			Usage:  "Deny memory consuming actions while the \"some\" memory pressure percentage exceeds this value",
+		},
+
+		cli.Float64Flag{
+			Name:   pressureFullFlag,
+			EnvVar: "PRESSURE_FULL_THRESHOLD",
+			Usage:  "Deny memory consuming actions while the \"full\" memory pressure percentage exceeds this value",
+		},
+
+		cli.StringFlag{
+			Name:   minMemAvailableFlag,
+			EnvVar: "MIN_MEM_AVAILABLE",
+			Usage:  "Deny memory consuming actions while the host available memory is below this size (e.g. 1g)",
+		},
+
+		cli.StringFlag{
+			Name:   memoryCapacityFlag,
+			EnvVar: "MEMORY_CAPACITY",
+			Usage:  "Defines the memory available for containers (e.g. 32g), defaults to the host memory",
+		},
+
+		cli.BoolFlag{
+			Name:   cgroupAwareFlag,
+			Usage:  "Bound the capacity by the cgroup memory limits and check containers against their cgroup parent limit",
+			EnvVar: "CGROUP_AWARE",
+		},
+
+		cli.StringFlag{
+			Name:   cgroupRootFlag,
+			Value:  "/sys/fs/cgroup",
+			EnvVar: "CGROUP_ROOT",
+			Usage:  "Defines where the cgroup hierarchy is mounted",
+		},
+
+		cli.StringFlag{
+			Name:   cgroupPathFlag,
+			Value:  "docker",
+			EnvVar: "CGROUP_PATH",
+			Usage:  "Defines the cgroup containers run under when they set no cgroup parent (e.g. system.slice)",
+		},
+
+		cli.IntFlag{
+			Name:   oomRepeatCountFlag,
+			EnvVar: "OOM_REPEAT_COUNT",
+			Usage:  "Deny creating an image OOM killed this many times unless a larger limit is requested, 0 disables the policy",
+		},
+
+		cli.DurationFlag{
+			Name:   oomWindowFlag,
+			Value:  24 * time.Hour,
+			EnvVar: "OOM_WINDOW",
+			Usage:  "Defines the period OOM kills are counted over",
+		},
+
+		cli.BoolFlag{
+			Name:   recommendationsFlag,
+			Usage:  "Learn the memory usage of every image to recommend memory limits",
+			EnvVar: "RECOMMENDATIONS",
+		},
+
+		cli.BoolFlag{
+			Name:   recommendInDenyFlag,
+			Usage:  "Include the recommended memory limit in container create deny messages",
+			EnvVar: "RECOMMEND_IN_DENY",
+		},
+
+		cli.StringFlag{
+			Name:   imageRulesFlag,
+			EnvVar: "IMAGE_RULES",
+			Usage:  "Defines a JSON file of per image memory rules (image pattern, min, max, recommended)",
+		},
+
+		cli.BoolFlag{
+			Name:   enforceDefaultFlag,
+			Usage:  "Apply a default memory limit to containers created without one",
+			EnvVar: "ENFORCE_DEFAULT_LIMIT",
+		},
+
+		cli.StringFlag{
+			Name:   defaultLimitFlag,
+			EnvVar: "DEFAULT_MEMORY_LIMIT",
+			Usage:  "Defines the default memory limit when no image rule or tenant default applies (e.g. 512m)",
+		},
+
+		cli.StringSliceFlag{
+			Name:  tenantDefaultFlag,
+			Usage: "Defines the default memory limit of a tenant as tenant=size, can be repeated",
+		},
+
+		cli.DurationFlag{
+			Name:   sweepIntervalFlag,
+			EnvVar: "SWEEP_INTERVAL",
+			Usage:  "Defines the delay between two policy violation sweeps of running containers, 0 disables sweeping",
+		},
+
+		cli.StringFlag{
+			Name:   sweepActionFlag,
+			Value:  authz.SweepActionLog,
+			EnvVar: "SWEEP_ACTION",
+			Usage:  "Defines the action taken on containers violating the policy (log, pause, stop, update)",
+		},
+
+		cli.BoolFlag{
+			Name:   sweepDryRunFlag,
+			Usage:  "Only log the actions a sweep would take",
+			EnvVar: "SWEEP_DRY_RUN",
+		},
+
+		cli.IntFlag{
+			Name:   sweepMaxActionsFlag,
+			Value:  10,
+			EnvVar: "SWEEP_MAX_ACTIONS",
+			Usage:  "Defines the maximal number of actions taken by a single sweep",
+		},
+
+		cli.StringFlag{
+			Name:   bodyUnavailableFlag,
+			Value:  authz.BodyUnavailableVerify,
+			EnvVar: "BODY_UNAVAILABLE",
+			Usage:  "Defines how container creates without forwarded body are handled (deny, verify)",
+		},
+
+		cli.StringFlag{
+			Name:   unknownRoutesFlag,
+			Value:  authz.UnknownRouteDeny,
+			EnvVar: "UNKNOWN_ROUTES",
+			Usage:  "Defines how requests matching no known docker API route are handled (allow, deny, audit)",
+		},
+
+		cli.StringSliceFlag{
+			Name:   unknownRouteAllowFlag,
+			EnvVar: "UNKNOWN_ROUTE_ALLOW",
+			Usage:  "Allows unknown docker API routes matching a method and path glob (e.g. \"GET /distribution/*/json\")",
+		},
+
+		cli.StringFlag{
+			Name:   policyFileFlag,
+			EnvVar: "POLICY_FILE",
+			Usage:  "Defines the JSON policy file with capacities, quotas, rules and defaults, reloaded on SIGHUP and on change",
+		},
+
+		cli.DurationFlag{
+			Name:   policyPollFlag,
+			Value:  10 * time.Second,
+			EnvVar: "POLICY_POLL_INTERVAL",
+			Usage:  "Defines the delay between two checks of the policy file modification time",
+		},
+
+		cli.StringFlag{
+			Name:   enforcementFlag,
+			Value:  authz.EnforcementEnforce,
+			EnvVar: "ENFORCEMENT",
+			Usage:  "Defines whether failing checks deny requests (enforce) or are only logged and counted (audit)",
+		},
+
+		cli.StringFlag{
+			Name:   auditHookFlag,
+			Value:  authz.AuditHookStdout,
+			EnvVar: "AUDIT_HOOK",
+			Usage:  "Defines where the JSON audit records of the decisions are written (file, syslog, none), stdout when empty",
+		},
+
+		cli.StringFlag{
+			Name:   auditLogPathFlag,
+			Value:  "/var/log/authz-broker.log",
+			EnvVar: "AUDIT_LOG_PATH",
+			Usage:  "Defines the audit log file of the file audit hook",
+		},
+
+		cli.StringFlag{
+			Name:   auditMaxSizeFlag,
+			Value:  "100m",
+			EnvVar: "AUDIT_MAX_SIZE",
+			Usage:  "Defines the size the audit log file is rotated at (e.g. 100m), empty disables rotation",
+		},
+
+		cli.IntFlag{
+			Name:   auditMaxBackupsFlag,
+			Value:  10,
+			EnvVar: "AUDIT_MAX_BACKUPS",
+			Usage:  "Defines the number of rotated audit log files kept",
+		},
+
+		cli.BoolFlag{
+			Name:   auditCompressFlag,
+			EnvVar: "AUDIT_COMPRESS",
+			Usage:  "Compress the rotated audit log files with gzip",
+		},
+
+		cli.StringFlag{
+			Name:   auditBodyFlag,
+			Value:  authz.BodyRedactionSensitive,
+			EnvVar: "AUDIT_BODY_REDACTION",
+			Usage:  "Defines how request bodies are redacted in the audit records (all, sensitive, none)",
+		},
+
+		cli.StringFlag{
+			Name:   auditKeyFlag,
+			Value:  "/var/lib/authz-broker/audit.key",
+			EnvVar: "AUDIT_KEY",
+			Usage:  "Defines the ed25519 key signing the audit log checkpoints, generated with its .pub public key if missing",
+		},
+
+		cli.DurationFlag{
+			Name:   auditCheckpointFlag,
+			Value:  5 * time.Minute,
+			EnvVar: "AUDIT_CHECKPOINT_INTERVAL",
+			Usage:  "Defines the delay between two signed checkpoints of the audit log, 0 disables checkpoints",
+		},
+
+		cli.StringFlag{
+			Name:   metricsListenFlag,
+			EnvVar: "METRICS_LISTEN",
+			Usage:  "Defines the address serving Prometheus metrics on /metrics (e.g. :9323), empty disables the metrics listener",
 		},
 	}
 
+	app.Commands = []cli.Command{
+		recommendationsCommand,
+		wouldDenyCommand,
+		auditCommand,
+	}
+
 	app.Run(os.Args)
 }
 
+// newAuthorizer creates the authorizer of the given handler type
+func newAuthorizer(c *cli.Context, handler string) core.AuthorizerV2 {
+	switch handler {
+	case authorizerBasic:
+		var imageRules []authz.ImageRule
+		if file := c.GlobalString(imageRulesFlag); file != "" {
+			var err error
+			if imageRules, err = authz.LoadImageRules(file); err != nil {
+				panic(err)
+			}
+		}
+		settings := &authz.BasicAuthorizerSettings{
+			MemoryModel:       c.GlobalString(memoryModelFlag),
+			CountKernelMemory: c.GlobalBool(countKernelMemoryFlag),
+			QoS:               c.GlobalBool(qosFlag),
+			BurstCapacity:     sizeFlag(c, burstCapacityFlag),
+			BestEffortPool:    sizeFlag(c, bestEffortPoolFlag),
+			BestEffortCharge:  sizeFlag(c, bestEffortChargeFlag),
+
+			UsageAware:         c.GlobalBool(usageAwareFlag),
+			UsageHeadroom:      sizeFlag(c, usageHeadroomFlag),
+			StatsInterval:      c.GlobalDuration(statsIntervalFlag),
+			StatsMaxContainers: c.GlobalInt(statsMaxFlag),
+			StatsWindow:        c.GlobalInt(statsWindowFlag),
+
+			MeminfoPath:           c.GlobalString(meminfoPathFlag),
+			PressurePath:          c.GlobalString(pressurePathFlag),
+			PressureWindow:        c.GlobalString(pressureWindowFlag),
+			PressureSomeThreshold: c.GlobalFloat64(pressureSomeFlag),
+			PressureFullThreshold: c.GlobalFloat64(pressureFullFlag),
+			MinMemAvailable:       sizeFlag(c, minMemAvailableFlag),
+
+			MemoryCapacity: sizeFlag(c, memoryCapacityFlag),
+			CgroupAware:    c.GlobalBool(cgroupAwareFlag),
+			CgroupRoot:     c.GlobalString(cgroupRootFlag),
+			CgroupPath:     c.GlobalString(cgroupPathFlag),
+
+			OOMRepeatCount: c.GlobalInt(oomRepeatCountFlag),
+			OOMWindow:      c.GlobalDuration(oomWindowFlag),
+
+			Recommendations: c.GlobalBool(recommendationsFlag),
+			RecommendInDeny: c.GlobalBool(recommendInDenyFlag),
+
+			ImageRules: imageRules,
+
+			EnforceDefaultLimit: c.GlobalBool(enforceDefaultFlag),
+			DefaultMemoryLimit:  sizeFlag(c, defaultLimitFlag),
+			TenantDefaultLimits: tenantSizesFlag(c, tenantDefaultFlag),
+
+			SweepInterval:   c.GlobalDuration(sweepIntervalFlag),
+			SweepAction:     c.GlobalString(sweepActionFlag),
+			SweepDryRun:     c.GlobalBool(sweepDryRunFlag),
+			SweepMaxActions: c.GlobalInt(sweepMaxActionsFlag),
+
+			BodyUnavailablePolicy: c.GlobalString(bodyUnavailableFlag),
+
+			UnknownRoutePolicy:    c.GlobalString(unknownRoutesFlag),
+			UnknownRouteAllowlist: c.GlobalStringSlice(unknownRouteAllowFlag),
+
+			PolicyFile:         c.GlobalString(policyFileFlag),
+			PolicyPollInterval: c.GlobalDuration(policyPollFlag),
+
+			EnforcementMode: c.GlobalString(enforcementFlag),
+		}
+		return authz.NewBasicAuthZAuthorizer(settings)
+	}
+	panic(fmt.Sprintf("Unkwon authz hander %q", handler))
+}
+
+// sizeFlag parses a human readable memory size flag, an empty flag is parsed as zero
+func sizeFlag(c *cli.Context, name string) int64 {
+	value := c.GlobalString(name)
+	if value == "" {
+		return 0
+	}
+	size, err := units.RAMInBytes(value)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid size %q for flag %q", value, name))
+	}
+	return size
+}
+
+// tenantSizesFlag parses a repeated tenant=size flag
+func tenantSizesFlag(c *cli.Context, name string) map[string]authz.MemorySize {
+	sizes := make(map[string]authz.MemorySize)
+	for _, value := range c.GlobalStringSlice(name) {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			panic(fmt.Sprintf("Invalid value %q for flag %q, expected tenant=size", value, name))
+		}
+		size, err := units.RAMInBytes(parts[1])
+		if err != nil {
+			panic(fmt.Sprintf("Invalid size %q for flag %q", parts[1], name))
+		}
+		sizes[parts[0]] = authz.MemorySize(size)
+	}
+	return sizes
+}
+
 // initLogger initialize the logger based on the log level
 func initLogger(debug bool) {
 
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	// AuditPhaseRequest marks the records of request authorizations
+	AuditPhaseRequest = "request"
+	// AuditPhaseResponse marks the records of response authorizations
+	AuditPhaseResponse = "response"
+	// AuditPhaseCheckpoint marks the signed checkpoints of the audit log hash chain
+	AuditPhaseCheckpoint = "checkpoint"
+)
+
+// LedgerState is the memory committed on the host and to a tenant, in bytes
+type LedgerState struct {
+	Capacity    int64 `json:"capacity"`               // Capacity is the memory available for containers
+	Used        int64 `json:"used"`                   // Used is the memory committed to containers
+	TenantUsed  int64 `json:"tenant_used,omitempty"`  // TenantUsed is the memory committed to the containers of the tenant
+	TenantQuota int64 `json:"tenant_quota,omitempty"` // TenantQuota is the memory quota of the tenant, zero if it has none
+}
+
+// LedgerReporter is implemented by authorizers keeping track of the memory committed to containers
+type LedgerReporter interface {
+	// LedgerState returns the memory committed on the host and to the given tenant
+	LedgerState(tenant string) LedgerState
+}
+
+// AuditRecord is the audit trail of a single authorization decision
+type AuditRecord struct {
+	Seq            uint64          `json:"seq,omitempty"`             // Seq is the position of the record in the audit log hash chain
+	PrevHash       string          `json:"prev_hash,omitempty"`       // PrevHash is the hash of the previous record of the chain
+	Timestamp      time.Time       `json:"timestamp"`                 // Timestamp is when the authorization started
+	Phase          string          `json:"phase"`                     // Phase is request or response
+	User           string          `json:"user,omitempty"`            // User is the authenticated user
+	Tenant         string          `json:"tenant,omitempty"`          // Tenant is the tenant the request is issued for
+	Method         string          `json:"method"`                    // Method is the HTTP method of the request
+	URI            string          `json:"uri"`                       // URI is the request URI
+	Action         string          `json:"action"`                    // Action is the docker action
+	ResourceID     string          `json:"resource_id,omitempty"`     // ResourceID is the resource targeted or created by the request
+	Decision       string          `json:"decision"`                  // Decision is the result of the authorization
+	Reason         string          `json:"reason,omitempty"`          // Reason is the machine readable reason code
+	Message        string          `json:"message,omitempty"`         // Message is the message sent to the docker client
+	Rule           string          `json:"rule,omitempty"`            // Rule is the policy rule that matched, if any
+	Authorizer     string          `json:"authorizer,omitempty"`      // Authorizer is the chain member that decided, if any
+	ResponseStatus int             `json:"response_status,omitempty"` // ResponseStatus is the daemon status code of response authorizations
+	LedgerBefore   *LedgerState    `json:"ledger_before,omitempty"`   // LedgerBefore is the ledger state before the authorization
+	LedgerAfter    *LedgerState    `json:"ledger_after,omitempty"`    // LedgerAfter is the ledger state after the authorization
+	LatencyMs      float64         `json:"latency_ms"`                // LatencyMs is the time the authorization took in milliseconds
+	Body           json.RawMessage `json:"body,omitempty"`            // Body is the JSON request body, subject to redaction by the auditor
+	Signature      string          `json:"signature,omitempty"`       // Signature signs the sequence and previous hash of checkpoints
+	Hash           string          `json:"hash,omitempty"`            // Hash is the hash of the record, appended last when the record is sealed
+}
+
+// Auditor writes the audit trail of authorization decisions
+type Auditor interface {
+	// Init initializes the auditor
+	Init() error
+	// Audit writes the record of a decision
+	Audit(record *AuditRecord) error
+}
+
+// newAuditRecord fills the request fields of an audit record
+func newAuditRecord(phase string, req *RequestContext, start time.Time) *AuditRecord {
+	record := &AuditRecord{
+		Timestamp:  start,
+		Phase:      phase,
+		User:       req.User,
+		Tenant:     req.Tenant,
+		Method:     req.RequestMethod,
+		URI:        req.RequestURI,
+		Action:     req.Action,
+		ResourceID: req.ID(),
+	}
+	if req.IsJSON() && json.Valid(req.RequestBody) {
+		record.Body = json.RawMessage(req.RequestBody)
+	}
+	if record.ResourceID == "" && phase == AuditPhaseResponse && strings.HasSuffix(req.Action, "_create") {
+		record.ResourceID = createdID(req.ResponseBody)
+	}
+	return record
+}
+
+// createdID returns the id of the resource a create response reports ("Id" or "ID"), if any
+func createdID(body []byte) string {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if len(body) == 0 || json.Unmarshal(body, &created) != nil {
+		return ""
+	}
+	return created.ID
+}
+
+// ledgerState returns the ledger state of the tenant if the authorizer keeps a ledger
+func ledgerState(authorizer AuthorizerV2, tenant string) *LedgerState {
+	reporter, ok := authorizer.(LedgerReporter)
+	if !ok {
+		return nil
+	}
+	state := reporter.LedgerState(tenant)
+	return &state
+}
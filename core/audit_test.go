@@ -0,0 +1,80 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// recordingAuditor keeps the records it is given
+type recordingAuditor struct {
+	records []*AuditRecord
+}
+
+func (r *recordingAuditor) Init() error { return nil }
+func (r *recordingAuditor) Audit(record *AuditRecord) error {
+	r.records = append(r.records, record)
+	return nil
+}
+
+// chargingAuthorizer charges every allowed request to its ledger
+type chargingAuthorizer struct {
+	used int64
+}
+
+func (c *chargingAuthorizer) Init() error { return nil }
+func (c *chargingAuthorizer) AuthorizeRequest(ctx context.Context, req *RequestContext) Decision {
+	c.used += 512
+	return Allow()
+}
+func (c *chargingAuthorizer) AuthorizeResponse(ctx context.Context, req *RequestContext) Decision {
+	return Allow()
+}
+func (c *chargingAuthorizer) LedgerState(tenant string) LedgerState {
+	return LedgerState{Capacity: 1024, Used: c.used}
+}
+
+func TestAudit(t *testing.T) {
+
+	auditor := &recordingAuditor{}
+	chain, err := NewChain(ChainAllMustAllow, []ChainMember{
+		{Name: "fixed", Authorizer: &fixedAuthorizer{decision: Allow()}},
+		{Name: "charging", Authorizer: &chargingAuthorizer{}},
+	})
+	assert.NoError(t, err)
+	srv := NewAuthZSrv(chain)
+	srv.SetAuditor(auditor)
+
+	req := &authorization.Request{
+		User:           "alice",
+		RequestMethod:  "POST",
+		RequestURI:     "/v1.24/containers/create",
+		RequestBody:    []byte(`{"Image":"busybox"}`),
+		RequestHeaders: map[string]string{TenantIDHeaderName: "team-a"},
+	}
+	decision := srv.audited(AuditPhaseRequest, NewRequestContext(req), chain.AuthorizeRequest)
+	assert.Equal(t, DecisionAllow, decision.Result)
+
+	req.ResponseStatusCode = 201
+	req.ResponseBody = []byte(`{"Id":"4fa6e0f0c678","Warnings":null}`)
+	srv.audited(AuditPhaseResponse, NewRequestContext(req), chain.AuthorizeResponse)
+
+	assert.Len(t, auditor.records, 2)
+	record := auditor.records[0]
+	assert.Equal(t, AuditPhaseRequest, record.Phase)
+	assert.Equal(t, "alice", record.User)
+	assert.Equal(t, "team-a", record.Tenant)
+	assert.Equal(t, ActionContainerCreate, record.Action)
+	assert.Equal(t, DecisionAllow, record.Decision)
+	assert.Equal(t, &LedgerState{Capacity: 1024}, record.LedgerBefore)
+	assert.Equal(t, &LedgerState{Capacity: 1024, Used: 512}, record.LedgerAfter)
+	assert.Equal(t, `{"Image":"busybox"}`, string(record.Body))
+	assert.Empty(t, record.ResourceID)
+
+	record = auditor.records[1]
+	assert.Equal(t, AuditPhaseResponse, record.Phase)
+	assert.Equal(t, "4fa6e0f0c678", record.ResourceID)
+	assert.Equal(t, 201, record.ResponseStatus)
+}
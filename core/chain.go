@@ -0,0 +1,153 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+const (
+	// ChainAllMustAllow allows a request only if every enforcing member allows it
+	ChainAllMustAllow = "all"
+	// ChainFirstDecisive lets the first enforcing member that does not abstain decide
+	ChainFirstDecisive = "first"
+)
+
+// ChainMember is an authorizer of a chain
+type ChainMember struct {
+	Name       string       // Name identifies the member in deny messages and logs
+	Authorizer AuthorizerV2 // Authorizer is the member authorizer
+	Audit      bool         // Audit only logs the decisions of the member, which never refuses anything
+}
+
+// Chain combines an ordered list of authorizers into a single one
+type Chain struct {
+	mode    string
+	members []ChainMember
+}
+
+// NewChain creates an authorizer chain with the given combination mode
+func NewChain(mode string, members []ChainMember) (*Chain, error) {
+	if mode != ChainAllMustAllow && mode != ChainFirstDecisive {
+		return nil, fmt.Errorf("Unknown authorizer chain mode %q", mode)
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("Authorizer chain has no member")
+	}
+	return &Chain{mode: mode, members: members}, nil
+}
+
+// Init initializes every member of the chain
+func (c *Chain) Init() error {
+	for _, member := range c.members {
+		if err := member.Authorizer.Init(); err != nil {
+			return fmt.Errorf("Failed to initialize authorizer %s: %v", member.Name, err)
+		}
+	}
+	return nil
+}
+
+// AuthorizeRequest runs the request through the members in order, members after the deciding one are skipped.
+// When the chain refuses the request, the members that allowed it release what they charged for it
+func (c *Chain) AuthorizeRequest(ctx context.Context, req *RequestContext) Decision {
+	var allowed []memberDecision
+	for _, member := range c.members {
+		decision := member.Authorizer.AuthorizeRequest(ctx, req)
+		if decision.Result == DecisionAllow {
+			allowed = append(allowed, memberDecision{member, decision})
+		}
+		if member.Audit {
+			c.audit(member, req, decision)
+			continue
+		}
+		if decided, ok := c.decisive(member, decision); ok {
+			if !decided.Allowed() {
+				c.release(allowed, req)
+			}
+			return decided
+		}
+	}
+	return Allow()
+}
+
+// memberDecision is the decision of a chain member on a request
+type memberDecision struct {
+	member   ChainMember
+	decision Decision
+}
+
+// release has the members that allowed a request refused by the chain release what they charged for it,
+// last member first
+func (c *Chain) release(allowed []memberDecision, req *RequestContext) {
+	for i := len(allowed) - 1; i >= 0; i-- {
+		if releaser, ok := allowed[i].member.Authorizer.(Releaser); ok {
+			releaser.ReleaseRequest(req, allowed[i].decision)
+		}
+	}
+}
+
+// AuthorizeResponse runs the response through every member, which may keep track of created resources,
+// and returns the decision of the chain
+func (c *Chain) AuthorizeResponse(ctx context.Context, req *RequestContext) Decision {
+	result := Allow()
+	decided := false
+	for _, member := range c.members {
+		decision := member.Authorizer.AuthorizeResponse(ctx, req)
+		if member.Audit {
+			c.audit(member, req, decision)
+			continue
+		}
+		if memberDecision, ok := c.decisive(member, decision); ok && !decided {
+			result, decided = memberDecision, true
+		}
+	}
+	return result
+}
+
+// decisive returns the decision of the chain if the member decision settles it
+func (c *Chain) decisive(member ChainMember, decision Decision) (Decision, bool) {
+	switch decision.Result {
+	case DecisionAllow:
+		return decision, c.mode == ChainFirstDecisive
+	case DecisionAbstain:
+		return decision, false
+	}
+	decision.Authorizer = member.Name
+	decision.Message = fmt.Sprintf("%s [authorizer: %s]", decision.Message, member.Name)
+	return decision, true
+}
+
+// audit logs the decision of an audit only member
+func (c *Chain) audit(member ChainMember, req *RequestContext, decision Decision) {
+	if decision.Allowed() {
+		return
+	}
+	logrus.Warnf("Audit authorizer %s decided %s on %s %s: %s", member.Name, decision.Result, req.RequestMethod, req.RequestURI, decision.Message)
+}
+
+// AdminRoutes exposes the administrative queries of every member
+func (c *Chain) AdminRoutes() map[string]http.HandlerFunc {
+	routes := make(map[string]http.HandlerFunc)
+	for _, member := range c.members {
+		if admin, ok := member.Authorizer.(AdminHandler); ok {
+			for name, handler := range admin.AdminRoutes() {
+				routes[name] = handler
+			}
+		}
+	}
+	return routes
+}
+
+// LedgerState returns the ledger state of the first member keeping a ledger
+func (c *Chain) LedgerState(tenant string) LedgerState {
+	for _, member := range c.members {
+		if reporter, ok := member.Authorizer.(LedgerReporter); ok {
+			if state := reporter.LedgerState(tenant); state != (LedgerState{}) {
+				return state
+			}
+		}
+	}
+	return LedgerState{}
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// fixedAuthorizer returns the same decision for every request and counts the responses and releases it saw
+type fixedAuthorizer struct {
+	decision  Decision
+	responses int
+	releases  int
+}
+
+func (f *fixedAuthorizer) Init() error { return nil }
+func (f *fixedAuthorizer) AuthorizeRequest(ctx context.Context, req *RequestContext) Decision {
+	return f.decision
+}
+func (f *fixedAuthorizer) AuthorizeResponse(ctx context.Context, req *RequestContext) Decision {
+	f.responses++
+	return Allow()
+}
+func (f *fixedAuthorizer) ReleaseRequest(req *RequestContext, decision Decision) {
+	f.releases++
+}
+
+func TestChain(t *testing.T) {
+
+	deny := Deny("not_enough_memory", "Not enough Memory")
+	abstain := Decision{Result: DecisionAbstain}
+
+	tests := []struct {
+		mode       string
+		decisions  []Decision
+		audit      []bool
+		result     string
+		authorizer string
+		releases   []int // releases are the number of releases by member, members allowing a denied request release it
+	}{
+		{ChainAllMustAllow, []Decision{Allow(), Allow()}, []bool{false, false}, DecisionAllow, "", []int{0, 0}},
+		{ChainAllMustAllow, []Decision{Allow(), deny}, []bool{false, false}, DecisionDeny, "m1", []int{1, 0}},
+		{ChainAllMustAllow, []Decision{Allow(), deny}, []bool{true, false}, DecisionDeny, "m1", []int{1, 0}},
+		{ChainAllMustAllow, []Decision{deny, Allow()}, []bool{true, false}, DecisionAllow, "", []int{0, 0}},
+		{ChainAllMustAllow, []Decision{abstain, deny}, []bool{false, false}, DecisionDeny, "m1", []int{0, 0}},
+		{ChainFirstDecisive, []Decision{Allow(), deny}, []bool{false, false}, DecisionAllow, "", []int{0, 0}},
+		{ChainFirstDecisive, []Decision{abstain, deny}, []bool{false, false}, DecisionDeny, "m1", []int{0, 0}},
+		{ChainFirstDecisive, []Decision{abstain, abstain}, []bool{false, false}, DecisionAllow, "", []int{0, 0}},
+		{ChainFirstDecisive, []Decision{deny, Allow()}, []bool{true, false}, DecisionAllow, "", []int{0, 0}},
+	}
+
+	req := NewRequestContext(&authorization.Request{RequestMethod: "POST", RequestURI: "/v1.24/containers/create"})
+	for _, test := range tests {
+		var members []ChainMember
+		var authorizers []*fixedAuthorizer
+		for i, decision := range test.decisions {
+			authorizer := &fixedAuthorizer{decision: decision}
+			authorizers = append(authorizers, authorizer)
+			members = append(members, ChainMember{Name: "m" + string('0'+rune(i)), Authorizer: authorizer, Audit: test.audit[i]})
+		}
+		chain, err := NewChain(test.mode, members)
+		assert.NoError(t, err)
+
+		decision := chain.AuthorizeRequest(context.Background(), req)
+		assert.Equal(t, test.result, decision.Result, "%s %v", test.mode, test.decisions)
+		assert.Equal(t, test.authorizer, decision.Authorizer, "%s %v", test.mode, test.decisions)
+		if test.result == DecisionDeny {
+			assert.Equal(t, "Not enough Memory [authorizer: m1]", decision.Message)
+		}
+
+		assert.True(t, chain.AuthorizeResponse(context.Background(), req).Allowed())
+		for i, authorizer := range authorizers {
+			assert.Equal(t, 1, authorizer.responses)
+			assert.Equal(t, test.releases[i], authorizer.releases, "%s %v", test.mode, test.decisions)
+		}
+	}
+
+	_, err := NewChain("any", []ChainMember{{Name: "m0", Authorizer: &fixedAuthorizer{}}})
+	assert.Error(t, err)
+	_, err = NewChain(ChainAllMustAllow, nil)
+	assert.Error(t, err)
+}
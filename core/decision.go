@@ -0,0 +1,130 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/docker/docker/pkg/authorization"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DecisionAllow lets the request or response through
+	DecisionAllow = "allow"
+	// DecisionDeny refuses the request or response
+	DecisionDeny = "deny"
+	// DecisionError reports the authorizer failed to reach a decision
+	DecisionError = "error"
+	// DecisionAbstain reports the authorizer has no opinion on the request, it counts as an allow outside of chains
+	DecisionAbstain = "abstain"
+)
+
+const (
+	// ReasonDenied is the reason code of denials from authorizers without reason codes
+	ReasonDenied = "denied"
+	// ReasonError is the reason code of errors from authorizers without reason codes
+	ReasonError = "error"
+	// ReasonTimeout is the reason code of authorizations that did not complete before their deadline
+	ReasonTimeout = "timeout"
+)
+
+// Decision is the structured outcome of an authorization
+type Decision struct {
+	Result     string `json:"result"`               // Result is the decision (allow, deny, error, abstain)
+	Reason     string `json:"reason,omitempty"`     // Reason is the machine readable reason code (e.g. "not_enough_memory")
+	Message    string `json:"message,omitempty"`    // Message is the human readable message shown to the docker client
+	Rule       string `json:"rule,omitempty"`       // Rule is the policy rule that matched, if any
+	Cost       int64  `json:"cost,omitempty"`       // Cost is the memory charged by the decision in bytes
+	Authorizer string `json:"authorizer,omitempty"` // Authorizer is the chain member that reached the decision, if any
+}
+
+// Allow returns an allow decision
+func Allow() Decision {
+	return Decision{Result: DecisionAllow}
+}
+
+// Deny returns a deny decision with the given reason code and message
+func Deny(reason, message string) Decision {
+	return Decision{Result: DecisionDeny, Reason: reason, Message: message}
+}
+
+// Allowed returns whether the decision lets the request or response through
+func (d Decision) Allowed() bool {
+	return d.Result == DecisionAllow || d.Result == DecisionAbstain
+}
+
+// Response converts the decision to the authorization plugin response sent to the daemon
+func (d Decision) Response() *authorization.Response {
+	switch d.Result {
+	case DecisionAllow, DecisionAbstain:
+		return &authorization.Response{Allow: true, Msg: d.Message}
+	case DecisionDeny:
+		return &authorization.Response{Allow: false, Msg: d.Message}
+	}
+	return &authorization.Response{Err: d.Message}
+}
+
+// AuthorizerV2 handles the authorization of parsed docker requests and responses with structured decisions,
+// implementations must return once the context is done
+type AuthorizerV2 interface {
+	// Init initialize the authorizer
+	Init() error
+	// AuthorizeRequest authorizes the request from docker client to docker daemon
+	AuthorizeRequest(ctx context.Context, req *RequestContext) Decision
+	// AuthorizeResponse authorizes the response from docker daemon to docker client
+	AuthorizeResponse(ctx context.Context, req *RequestContext) Decision
+}
+
+// Releaser is implemented by authorizers charging resources to the requests they allow
+type Releaser interface {
+	// ReleaseRequest releases what was charged for an allowed request that another authorizer refused
+	ReleaseRequest(req *RequestContext, decision Decision)
+}
+
+// authorizerAdapter runs an Authorizer as an AuthorizerV2
+type authorizerAdapter struct {
+	Authorizer
+}
+
+// AdaptAuthorizer wraps an Authorizer into an AuthorizerV2, denials and errors get generic reason codes
+func AdaptAuthorizer(authorizer Authorizer) AuthorizerV2 {
+	return &authorizerAdapter{Authorizer: authorizer}
+}
+
+// AuthorizeRequest authorizes the request with the wrapped authorizer
+func (a *authorizerAdapter) AuthorizeRequest(ctx context.Context, req *RequestContext) Decision {
+	return decisionOf(a.AuthZReq(req))
+}
+
+// AuthorizeResponse authorizes the response with the wrapped authorizer
+func (a *authorizerAdapter) AuthorizeResponse(ctx context.Context, req *RequestContext) Decision {
+	return decisionOf(a.AuthZRes(req))
+}
+
+// AdminRoutes exposes the administrative queries of the wrapped authorizer, if any
+func (a *authorizerAdapter) AdminRoutes() map[string]http.HandlerFunc {
+	if admin, ok := a.Authorizer.(AdminHandler); ok {
+		return admin.AdminRoutes()
+	}
+	return nil
+}
+
+// LedgerState returns the ledger state of the wrapped authorizer, if it keeps a ledger
+func (a *authorizerAdapter) LedgerState(tenant string) LedgerState {
+	if reporter, ok := a.Authorizer.(LedgerReporter); ok {
+		return reporter.LedgerState(tenant)
+	}
+	return LedgerState{}
+}
+
+// decisionOf converts an authorization plugin response to a decision
+func decisionOf(res *authorization.Response) Decision {
+	switch {
+	case res == nil:
+		return Decision{Result: DecisionError, Reason: ReasonError, Message: "Authorizer returned no response"}
+	case res.Err != "":
+		return Decision{Result: DecisionError, Reason: ReasonError, Message: res.Err}
+	case res.Allow:
+		return Decision{Result: DecisionAllow, Message: res.Msg}
+	}
+	return Deny(ReasonDenied, res.Msg)
+}
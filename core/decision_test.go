@@ -0,0 +1,78 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// staticAuthorizer answers every request and response with the same response
+type staticAuthorizer struct {
+	res *authorization.Response
+}
+
+func (s staticAuthorizer) Init() error                                          { return nil }
+func (s staticAuthorizer) AuthZReq(req *RequestContext) *authorization.Response { return s.res }
+func (s staticAuthorizer) AuthZRes(req *RequestContext) *authorization.Response { return s.res }
+
+func TestAuthorizerAdapter(t *testing.T) {
+
+	tests := []struct {
+		res      *authorization.Response
+		expected Decision
+	}{
+		{&authorization.Response{Allow: true}, Allow()},
+		{&authorization.Response{Msg: "Not enough Memory"}, Deny(ReasonDenied, "Not enough Memory")},
+		{&authorization.Response{Err: "boom"}, Decision{Result: DecisionError, Reason: ReasonError, Message: "boom"}},
+		{nil, Decision{Result: DecisionError, Reason: ReasonError, Message: "Authorizer returned no response"}},
+	}
+
+	req := NewRequestContext(&authorization.Request{RequestMethod: "GET", RequestURI: "/v1.24/info"})
+	for _, test := range tests {
+		authorizer := AdaptAuthorizer(staticAuthorizer{test.res})
+		assert.Equal(t, test.expected, authorizer.AuthorizeRequest(context.Background(), req))
+		assert.Equal(t, test.expected, authorizer.AuthorizeResponse(context.Background(), req))
+	}
+
+	assert.Equal(t, &authorization.Response{Allow: true}, Allow().Response())
+	assert.Equal(t, &authorization.Response{Msg: "no"}, Deny(ReasonDenied, "no").Response())
+	assert.Equal(t, &authorization.Response{Err: "boom"}, Decision{Result: DecisionError, Message: "boom"}.Response())
+}
+
+func TestAuthorizeDeadline(t *testing.T) {
+
+	req := NewRequestContext(&authorization.Request{RequestMethod: "GET", RequestURI: "/v1.24/info"})
+	decision := authorize(req, func(ctx context.Context, req *RequestContext) Decision {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		return Allow()
+	})
+	assert.True(t, decision.Allowed())
+
+	defer func(timeout time.Duration) { authorizationTimeout = timeout }(authorizationTimeout)
+	authorizationTimeout = 50 * time.Millisecond
+	start := time.Now()
+	decision = authorize(req, func(ctx context.Context, req *RequestContext) Decision {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return Allow()
+	})
+	assert.Equal(t, ReasonTimeout, decision.Reason)
+	assert.True(t, time.Since(start) >= authorizationTimeout)
+}
+
+func TestAuthorizePanic(t *testing.T) {
+
+	req := NewRequestContext(&authorization.Request{RequestMethod: "POST", RequestURI: "/v1.24/containers/create"})
+	decision := authorize(req, func(ctx context.Context, req *RequestContext) Decision {
+		panic("daemon unreachable")
+	})
+	assert.Equal(t, Decision{
+		Result:  DecisionError,
+		Reason:  ReasonError,
+		Message: "Authorization of POST /v1.24/containers/create failed: daemon unreachable",
+	}, decision)
+}
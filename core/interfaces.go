@@ -1,12 +1,22 @@
 package core
 
-import "github.com/docker/docker/pkg/authorization"
+import (
+	"net/http"
+
+	"github.com/docker/docker/pkg/authorization"
+)
 
 // Authorizer handles the authorization of docker requests and responses
 type Authorizer interface {
 	// Init initialize the authorizer
-	Init() error                                                 // Init initialize the handler
-	AuthZReq(req *authorization.Request) *authorization.Response // AuthZReq handles the request from docker client
+	Init() error                                          // Init initialize the handler
+	AuthZReq(req *RequestContext) *authorization.Response // AuthZReq handles the request from docker client
 	// to docker daemon
-	AuthZRes(req *authorization.Request) *authorization.Response // AuthZRes handles the response from docker daemon to docker client
+	AuthZRes(req *RequestContext) *authorization.Response // AuthZRes handles the response from docker daemon to docker client
+}
+
+// AdminHandler is implemented by authorizers exposing administrative queries on the plugin socket
+type AdminHandler interface {
+	// AdminRoutes returns the handlers served under /admin/ by name
+	AdminRoutes() map[string]http.HandlerFunc
 }
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"time"
+
+	"github.com/AuthzMemory/metrics"
+)
+
+// unknownActionLabel is the action label of the requests matching no known route
+const unknownActionLabel = "unknown"
+
+var (
+	// decisionsTotal counts the decisions by phase, action and result
+	decisionsTotal = metrics.NewCounter("authz_broker_decisions_total",
+		"Authorization decisions by phase, action and result.", "phase", "action", "result")
+	// decisionSeconds is the distribution of the time taken to decide by phase and action
+	decisionSeconds = metrics.NewHistogram("authz_broker_decision_duration_seconds",
+		"Time taken to reach authorization decisions by phase and action.", metrics.DefaultLatencyBuckets, "phase", "action")
+)
+
+// observeDecision records the result and latency of a decision
+func observeDecision(phase string, req *RequestContext, decision Decision, latency time.Duration) {
+	action := req.Action
+	if action == ActionNone {
+		action = unknownActionLabel
+	}
+	decisionsTotal.Inc(phase, action, decision.Result)
+	decisionSeconds.Observe(latency.Seconds(), phase, action)
+}
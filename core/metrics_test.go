@@ -0,0 +1,37 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecisionMetrics(t *testing.T) {
+
+	tests := []struct {
+		uri      string
+		decision Decision
+		auditor  Auditor
+		action   string
+	}{
+		{"/v1.24/containers/create", Allow(), nil, ActionContainerCreate},
+		{"/v1.24/containers/create", Deny(ReasonDenied, "Not enough Memory"), &recordingAuditor{}, ActionContainerCreate},
+		{"/v1.24/spaceships/launch", Deny(ReasonDenied, "Unknown route"), nil, unknownActionLabel},
+	}
+
+	for _, test := range tests {
+		srv := NewAuthZSrv(&fixedAuthorizer{decision: test.decision})
+		if test.auditor != nil {
+			srv.SetAuditor(test.auditor)
+		}
+		before := decisionsTotal.Value(AuditPhaseRequest, test.action, test.decision.Result)
+		observed := decisionSeconds.Count(AuditPhaseRequest, test.action)
+
+		req := NewRequestContext(&authorization.Request{RequestMethod: "POST", RequestURI: test.uri})
+		srv.audited(AuditPhaseRequest, req, srv.authorizer.AuthorizeRequest)
+
+		assert.Equal(t, before+1, decisionsTotal.Value(AuditPhaseRequest, test.action, test.decision.Result), test.uri)
+		assert.Equal(t, observed+1, decisionSeconds.Count(AuditPhaseRequest, test.action), test.uri)
+	}
+}
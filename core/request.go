@@ -0,0 +1,78 @@
+package core
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/docker/docker/pkg/authorization"
+)
+
+// TenantIDHeaderName is the HTTP header carrying the tenant a request is issued for
+var TenantIDHeaderName = "X-Auth-Tenantid"
+
+// RequestContext is a docker request parsed once and shared by every authorizer
+type RequestContext struct {
+	*authorization.Request // Request is the raw request forwarded by the daemon
+
+	Action  string            // Action is the docker action, ActionNone for unknown routes
+	Version string            // Version is the API version prefixing the path, empty for unversioned requests
+	Path    string            // Path is the request path without the version prefix and the query string
+	Params  map[string]string // Params are the named path parameters (id, name, execid, checkpoint)
+	Query   url.Values        // Query is the parsed query string (e.g. force, fromImage, filters)
+	Headers http.Header       // Headers are the request headers
+	Body    interface{}       // Body is the decoded JSON request body, nil if the body is empty or not JSON
+	User    string            // User is the authenticated user, empty without TLS client authentication
+	Tenant  string            // Tenant is the tenant the request is issued for
+}
+
+// NewRequestContext parses the route, headers and body of a docker request
+func NewRequestContext(req *authorization.Request) *RequestContext {
+	route := ParseRoute(req.RequestMethod, req.RequestURI)
+	headers := make(http.Header, len(req.RequestHeaders))
+	for name, value := range req.RequestHeaders {
+		headers.Set(name, value)
+	}
+	ctx := &RequestContext{
+		Request: req,
+		Action:  route.Action,
+		Version: route.Version,
+		Path:    route.Path,
+		Params:  route.Params,
+		Query:   route.Query,
+		Headers: headers,
+		User:    req.User,
+		Tenant:  headers.Get(TenantIDHeaderName),
+	}
+	if ctx.IsJSON() {
+		if err := json.Unmarshal(req.RequestBody, &ctx.Body); err != nil {
+			ctx.Body = nil
+		}
+	}
+	return ctx
+}
+
+// IsJSON returns whether the request carries a JSON body, the daemon only forwards bodies of JSON requests
+// and the docker client omits the content type on some of them
+func (ctx *RequestContext) IsJSON() bool {
+	if len(ctx.RequestBody) == 0 {
+		return false
+	}
+	contentType := ctx.Headers.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// DecodeBody decodes the JSON request body into the given value
+func (ctx *RequestContext) DecodeBody(v interface{}) error {
+	return json.Unmarshal(ctx.RequestBody, v)
+}
+
+// ID returns the container, image, volume, network, service or exec the request targets, if any
+func (ctx *RequestContext) ID() string {
+	return RouteMatch{Params: ctx.Params}.ID()
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/docker/docker/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestContext(t *testing.T) {
+
+	ctx := NewRequestContext(&authorization.Request{
+		User:           "alice",
+		RequestMethod:  "DELETE",
+		RequestURI:     "/v1.24/containers/web?force=1&v=1",
+		RequestHeaders: map[string]string{"X-Auth-Tenantid": "team-a", "content-type": "application/json"},
+	})
+	assert.Equal(t, ActionContainerDelete, ctx.Action)
+	assert.Equal(t, "1.24", ctx.Version)
+	assert.Equal(t, "web", ctx.ID())
+	assert.Equal(t, "1", ctx.Query.Get("force"))
+	assert.Equal(t, "alice", ctx.User)
+	assert.Equal(t, "team-a", ctx.Tenant)
+	assert.Equal(t, "application/json", ctx.Headers.Get("Content-Type"))
+	assert.False(t, ctx.IsJSON())
+	assert.Nil(t, ctx.Body)
+
+	ctx = NewRequestContext(&authorization.Request{
+		RequestMethod: "POST",
+		RequestURI:    "/v1.24/containers/create?name=web",
+		RequestBody:   []byte(`{"Image":"busybox","HostConfig":{"Memory":268435456,"Privileged":true}}`),
+	})
+	assert.Equal(t, ActionContainerCreate, ctx.Action)
+	assert.Equal(t, "web", ctx.Query.Get("name"))
+	assert.True(t, ctx.IsJSON())
+	body := ctx.Body.(map[string]interface{})
+	assert.Equal(t, "busybox", body["Image"])
+	assert.Equal(t, true, body["HostConfig"].(map[string]interface{})["Privileged"])
+
+	var decoded struct{ Image string }
+	assert.NoError(t, ctx.DecodeBody(&decoded))
+	assert.Equal(t, "busybox", decoded.Image)
+
+	ctx = NewRequestContext(&authorization.Request{
+		RequestMethod:  "POST",
+		RequestURI:     "/v1.24/build?memory=536870912",
+		RequestBody:    []byte("not json"),
+		RequestHeaders: map[string]string{"Content-Type": "application/x-tar"},
+	})
+	assert.Equal(t, ActionImageBuild, ctx.Action)
+	assert.Equal(t, "536870912", ctx.Query.Get("memory"))
+	assert.False(t, ctx.IsJSON())
+	assert.Nil(t, ctx.Body)
+}
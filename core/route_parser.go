@@ -1,11 +1,17 @@
 package core
 
-import "regexp"
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
 
 type route struct {
 	pattern string
 	method  string
 	action  string
+	regexp  *regexp.Regexp
 }
 
 var routes = []route{
@@ -13,80 +19,81 @@ var routes = []route{
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.20/#create-a-new-image-from-a-container-s-changes
 	{pattern: "/commit", method: "POST", action: ActionContainerCommit},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.20/#monitor-docker-s-events
-	{pattern: "/events", method: "POST", action: ActionDockerEvents},
+	{pattern: "/events", method: "GET", action: ActionDockerEvents},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.20/#show-the-docker-version-information
 	{pattern: "/version", method: "GET", action: ActionDockerVersion},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.20/#check-auth-configuration
 	{pattern: "/auth", method: "POST", action: ActionDockerCheckAuth},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#wait-a-container
-	{pattern: "/containers/(.+)/wait", method: "POST", action: ActionContainerWait},
+	{pattern: "/containers/{id}/wait", method: "POST", action: ActionContainerWait},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#resize-a-container-tty
-	{pattern: "/containers/(.+)/resize", method: "POST", action: ActionContainerResize},
+	{pattern: "/containers/{id}/resize", method: "POST", action: ActionContainerResize},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#export-a-container
-	{pattern: "/containers/(.+)/export", method: "POST", action: ActionContainerExport},
+	{pattern: "/containers/{id}/export", method: "GET", action: ActionContainerExport},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#export-a-container
-	{pattern: "/containers/(.+)/stop", method: "POST", action: ActionContainerStop},
+	{pattern: "/containers/{id}/stop", method: "POST", action: ActionContainerStop},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#kill-a-container
-	{pattern: "/containers/.*/kill", method: "POST", action: ActionContainerKill},
+	{pattern: "/containers/{id}/kill", method: "POST", action: ActionContainerKill},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#restart-a-container
-	{pattern: "/containers/(.+)/restart", method: "POST", action: ActionContainerRestart},
+	{pattern: "/containers/{id}/restart", method: "POST", action: ActionContainerRestart},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#start-a-container
-	{pattern: "/containers/(.+)/start", method: "POST", action: ActionContainerStart},
+	{pattern: "/containers/{id}/start", method: "POST", action: ActionContainerStart},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#exec-create
-	{pattern: "/containers/(.+)/exec", method: "POST", action: ActionContainerExecCreate},
+	{pattern: "/containers/{id}/exec", method: "POST", action: ActionContainerExecCreate},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#unpause-a-container
-	{pattern: "/containers/(.+)/unpause", method: "POST", action: ActionContainerUnpause},
+	{pattern: "/containers/{id}/unpause", method: "POST", action: ActionContainerUnpause},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#pause-a-container
-	{pattern: "/containers/(.+)/pause", method: "POST", action: ActionContainerPause},
+	{pattern: "/containers/{id}/pause", method: "POST", action: ActionContainerPause},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#copy-files-or-folders-from-a-container
-	{pattern: "/containers/(.+)/copy", method: "POST", action: ActionContainerCopyFiles},
+	{pattern: "/containers/{id}/copy", method: "POST", action: ActionContainerCopyFiles},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#extract-an-archive-of-files-or-folders-to-a-directory-in-a-container
-	{pattern: "/containers/(.+)/archive", method: "PUT", action: ActionContainerArchiveExtract},
-	{pattern: "/containers/(.+)/archive", method: "HEAD", action: ActionContainerArchiveInfo},
+	{pattern: "/containers/{id}/archive", method: "PUT", action: ActionContainerArchiveExtract},
+	{pattern: "/containers/{id}/archive", method: "HEAD", action: ActionContainerArchiveInfo},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#get-an-archive-of-a-filesystem-resource-in-a-container
-	{pattern: "/containers/(.+)/archive", method: "GET", action: ActionContainerArchive},
+	{pattern: "/containers/{id}/archive", method: "GET", action: ActionContainerArchive},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#attach-to-a-container-websocket
-	{pattern: "/containers/(.+)/attach/ws", method: "GET", action: ActionContainerAttachWs},
+	{pattern: "/containers/{id}/attach/ws", method: "GET", action: ActionContainerAttachWs},
 	// http://docs.docker.com/reference/api/docker_remote_api_v1.21/#attach-to-a-container
-	{pattern: "/containers/(.+)/attach", method: "POST", action: ActionContainerAttach},
+	{pattern: "/containers/{id}/attach", method: "POST", action: ActionContainerAttach},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#list-containers
 	{pattern: "/containers/json", method: "GET", action: ActionContainerList},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#inspect-a-container
-	{pattern: "/containers/(.+)/json", method: "GET", action: ActionContainerInspect},
+	{pattern: "/containers/{id}/json", method: "GET", action: ActionContainerInspect},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#remove-a-container
-	{pattern: "/containers/(.+)", method: "DELETE", action: ActionContainerDelete},
+	{pattern: "/containers/{id}", method: "DELETE", action: ActionContainerDelete},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#rename-a-container
-	{pattern: "/containers/(.+)/rename", method: "POST", action: ActionContainerRename},
+	{pattern: "/containers/{id}/rename", method: "POST", action: ActionContainerRename},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#get-container-stats-based-on-resource-usage
-	{pattern: "/containers/(.+)/stats", method: "GET", action: ActionContainerStats},
+	{pattern: "/containers/{id}/stats", method: "GET", action: ActionContainerStats},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#inspect-changes-on-a-container-s-filesystem
-	{pattern: "/containers/(.+)/changes", method: "GET", action: ActionContainerChanges},
+	{pattern: "/containers/{id}/changes", method: "GET", action: ActionContainerChanges},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#list-processes-running-inside-a-container
-	{pattern: "/containers/(.+)/top", method: "GET", action: ActionContainerTop},
+	{pattern: "/containers/{id}/top", method: "GET", action: ActionContainerTop},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#get-container-logs
-	{pattern: "/containers/(.+)/logs", method: "GET", action: ActionContainerLogs},
+	{pattern: "/containers/{id}/logs", method: "GET", action: ActionContainerLogs},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#create-a-container
 	{pattern: "/containers/create", method: "POST", action: ActionContainerCreate},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#get-a-tarball-containing-all-images
-	{pattern: "/images/(.+)./get", method: "GET", action: ActionImageArchive},
+	{pattern: "/images/get", method: "GET", action: ActionImageArchive},
+	{pattern: "/images/{name:.*}/get", method: "GET", action: ActionImageArchive},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#search-images
 	{pattern: "/images/search", method: "GET", action: ActionImagesSearch},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#tag-an-image-into-a-repository
-	{pattern: "/images/(.+)/tag", method: "POST", action: ActionImageTag},
+	{pattern: "/images/{name:.*}/tag", method: "POST", action: ActionImageTag},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#inspect-an-image
-	{pattern: "/images/(.+)/json", method: "GET", action: ActionImageInspect},
+	{pattern: "/images/{name:.*}/json", method: "GET", action: ActionImageInspect},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.18/#inspect-an-image
-	{pattern: "/images/(.+)", method: "DELETE", action: ActionImageDelete},
+	{pattern: "/images/{name:.*}", method: "DELETE", action: ActionImageDelete},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#get-the-history-of-an-image
-	{pattern: "/images/(.+)/history", method: "GET", action: ActionImageHistory},
+	{pattern: "/images/{name:.*}/history", method: "GET", action: ActionImageHistory},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#push-an-image-on-the-registry
-	{pattern: "/images/(.+)/push", method: "POST", action: ActionImagePush},
+	{pattern: "/images/{name:.*}/push", method: "POST", action: ActionImagePush},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#create-an-image
 	{pattern: "/images/create", method: "POST", action: ActionImageCreate},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#load-a-tarball-with-a-set-of-images-and-tags-into-docker
 	{pattern: "/images/load", method: "POST", action: ActionImageLoad},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#build-image-from-a-dockerfile
-	{pattern: "/images/build", method: "POST", action: ActionImageBuild},
+	{pattern: "/build", method: "POST", action: ActionImageBuild},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#list-images
 	{pattern: "/images/json", method: "GET", action: ActionImageList},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#ping-the-docker-server
@@ -94,54 +101,193 @@ var routes = []route{
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#display-system-wide-information
 	{pattern: "/info", method: "GET", action: ActionDockerInfo},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#exec-inspect
-	{pattern: "/exec/(.+)/json", method: "GET", action: ActionContainerExecInspect},
+	{pattern: "/exec/{execid}/json", method: "GET", action: ActionContainerExecInspect},
 	// https://docs.docker.com/reference/api/docker_remote_api_v1.21/#exec-start
-	{pattern: "/exec/(.+)/start", method: "POST", action: ActionContainerExecStart},
+	{pattern: "/exec/{execid}/start", method: "POST", action: ActionContainerExecStart},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#inspect-a-volume
-	{pattern: "/volumes/(.+)", method: "GET", action: ActionVolumeInspect},
+	{pattern: "/volumes/{name}", method: "GET", action: ActionVolumeInspect},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#list-volumes
 	{pattern: "/volumes", method: "GET", action: ActionVolumeList},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#create-a-volume
 	{pattern: "/volumes/create", method: "POST", action: ActionVolumeCreate},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#remove-a-volume
-	{pattern: "/volumes/(.+)", method: "DELETE", action: ActionVolumeRemove},
+	{pattern: "/volumes/{name}", method: "DELETE", action: ActionVolumeRemove},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#inspect-network
-	{pattern: "/networks/(.+)", method: "GET", action: ActionNetworkInspect},
+	{pattern: "/networks/{id}", method: "GET", action: ActionNetworkInspect},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#list-networks
 	{pattern: "/networks", method: "GET", action: ActionNetworkList},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#create-a-network
 	{pattern: "/networks/create", method: "POST", action: ActionNetworkCreate},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#connect-a-container-to-a-network
-	{pattern: "/networks/(.+)/connect", method: "POST", action: ActionNetworkConnect},
+	{pattern: "/networks/{id}/connect", method: "POST", action: ActionNetworkConnect},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#disconnect-a-container-from-a-network
-	{pattern: "/networks/(.+)/disconnect", method: "POST", action: ActionNetworkDisconnect},
+	{pattern: "/networks/{id}/disconnect", method: "POST", action: ActionNetworkDisconnect},
 	// https://docs.docker.com/engine/reference/api/docker_remote_api_v1.21/#remove-a-network
-	{pattern: "/networks/(.+)", method: "DELETE", action: ActionNetworkRemove},
+	{pattern: "/networks/{id}", method: "DELETE", action: ActionNetworkRemove},
 
 	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/create-a-service
 	{pattern: "/services/create", method: "POST", action: ActionServiceCreate},
 	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/inspect-one-or-more-services
-	{pattern: "/services/(.+)", method: "GET", action: ActionServiceInspect},
+	{pattern: "/services/{id}", method: "GET", action: ActionServiceInspect},
 	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/update-a-service
-	{pattern: "/services/(.+)", method: "POST", action: ActionServiceUpdate},
+	{pattern: "/services/{id}/update", method: "POST", action: ActionServiceUpdate},
+
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/update-a-container
+	{pattern: "/containers/{id}/update", method: "POST", action: ActionContainerUpdate},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/delete-stopped-containers
+	{pattern: "/containers/prune", method: "POST", action: ActionContainerPrune},
+	//https://github.com/docker/docker/blob/master/experimental/checkpoint-restore.md
+	{pattern: "/containers/{id}/checkpoints", method: "POST", action: ActionContainerCheckpointCreate},
+	{pattern: "/containers/{id}/checkpoints", method: "GET", action: ActionContainerCheckpointList},
+	{pattern: "/containers/{id}/checkpoints/{checkpoint}", method: "DELETE", action: ActionContainerCheckpointDelete},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/exec-resize
+	{pattern: "/exec/{execid}/resize", method: "POST", action: ActionContainerExecResize},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/delete-unused-images
+	{pattern: "/images/prune", method: "POST", action: ActionImagePrune},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/delete-unused-volumes
+	{pattern: "/volumes/prune", method: "POST", action: ActionVolumePrune},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/delete-unused-networks
+	{pattern: "/networks/prune", method: "POST", action: ActionNetworkPrune},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/show-docker-data-usage-information
+	{pattern: "/system/df", method: "GET", action: ActionSystemDataUsage},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/inspect-swarm
+	{pattern: "/swarm", method: "GET", action: ActionSwarmInspect},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/initialize-a-new-swarm
+	{pattern: "/swarm/init", method: "POST", action: ActionSwarmInit},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/join-an-existing-swarm
+	{pattern: "/swarm/join", method: "POST", action: ActionSwarmJoin},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/leave-a-swarm
+	{pattern: "/swarm/leave", method: "POST", action: ActionSwarmLeave},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/update-a-swarm
+	{pattern: "/swarm/update", method: "POST", action: ActionSwarmUpdate},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/list-nodes
+	{pattern: "/nodes", method: "GET", action: ActionNodeList},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/inspect-a-node
+	{pattern: "/nodes/{id}", method: "GET", action: ActionNodeInspect},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/remove-a-node
+	{pattern: "/nodes/{id}", method: "DELETE", action: ActionNodeRemove},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/update-a-node
+	{pattern: "/nodes/{id}/update", method: "POST", action: ActionNodeUpdate},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/list-services
+	{pattern: "/services", method: "GET", action: ActionServiceList},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/remove-a-service
+	{pattern: "/services/{id}", method: "DELETE", action: ActionServiceRemove},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/list-tasks
+	{pattern: "/tasks", method: "GET", action: ActionTaskList},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/inspect-a-task
+	{pattern: "/tasks/{id}", method: "GET", action: ActionTaskInspect},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/list-plugins
+	{pattern: "/plugins", method: "GET", action: ActionPluginList},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/install-a-plugin
+	{pattern: "/plugins/pull", method: "POST", action: ActionPluginPull},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/inspect-a-plugin
+	{pattern: "/plugins/{name:.*}", method: "GET", action: ActionPluginInspect},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/enable-a-plugin
+	{pattern: "/plugins/{name:.*}/enable", method: "POST", action: ActionPluginEnable},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/disable-a-plugin
+	{pattern: "/plugins/{name:.*}/disable", method: "POST", action: ActionPluginDisable},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/configure-a-plugin
+	{pattern: "/plugins/{name:.*}/set", method: "POST", action: ActionPluginSet},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/push-a-plugin
+	{pattern: "/plugins/{name:.*}/push", method: "POST", action: ActionPluginPush},
+	//https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/remove-a-plugin
+	{pattern: "/plugins/{name:.*}", method: "DELETE", action: ActionPluginRemove},
+}
+
+// routeParam matches the named parameters of route patterns, "{id}" matches a single path segment
+// and "{name:.*}" matches the rest of the path, as image names contain slashes
+var routeParam = regexp.MustCompile(`\{([a-z]+)(:\.\*)?\}`)
+
+func init() {
+	for i := range routes {
+		routes[i].regexp = compileRoute(routes[i].pattern)
+	}
+}
+
+// Actions returns the docker actions of the known routes in alphabetical order
+func Actions() []string {
+	seen := make(map[string]bool)
+	var actions []string
+	for _, r := range routes {
+		if !seen[r.action] {
+			seen[r.action] = true
+			actions = append(actions, r.action)
+		}
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// compileRoute converts a route pattern to an anchored regular expression
+func compileRoute(pattern string) *regexp.Regexp {
+	var expr string
+	last := 0
+	for _, loc := range routeParam.FindAllStringSubmatchIndex(pattern, -1) {
+		expr += regexp.QuoteMeta(pattern[last:loc[0]])
+		name := pattern[loc[2]:loc[3]]
+		if loc[4] >= 0 {
+			expr += "(?P<" + name + ">.+)"
+		} else {
+			expr += "(?P<" + name + ">[^/]+)"
+		}
+		last = loc[1]
+	}
+	expr += regexp.QuoteMeta(pattern[last:])
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+// RouteMatch is the docker action a request maps to along with the parsed parts of its url
+type RouteMatch struct {
+	Action  string            // Action is the docker action, ActionNone for unknown routes
+	Version string            // Version is the API version prefixing the path, empty for unversioned requests
+	Path    string            // Path is the request path without the version prefix and the query string
+	Params  map[string]string // Params are the named path parameters (id, name, execid, checkpoint)
+	Query   url.Values        // Query is the parsed query string
+}
+
+// ID returns the container, image, volume, network, service or exec the request targets, if any
+func (m RouteMatch) ID() string {
+	for _, name := range []string{"id", "name", "execid"} {
+		if value, ok := m.Params[name]; ok {
+			return value
+		}
+	}
+	return ""
 }
 
 // ParseRoute convert a method/url pattern to corresponding docker action
-func ParseRoute(method, url string) (string, string) {
-	var id string
-	for _, route := range routes {
-		if route.method == method {
-			match, err := regexp.MatchString(route.pattern, url)
+func ParseRoute(method, uri string) RouteMatch {
+	match := RouteMatch{Action: ActionNone, Version: APIVersion(uri), Params: map[string]string{}}
 
-			if err == nil && match {
-				parsedArr := regexp.MustCompile(route.pattern).FindStringSubmatch(url)
-				// logrus.Info(parsedArr)
-				if len(parsedArr) > 1 {
-					id = parsedArr[1]
-				}
-				return route.action, id
+	path := uri
+	if parsed, err := url.Parse(uri); err == nil {
+		path, match.Query = parsed.Path, parsed.Query()
+	} else if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	if match.Query == nil {
+		match.Query = url.Values{}
+	}
+	if loc := versionPrefix.FindStringIndex(path); loc != nil {
+		path = path[loc[1]-1:]
+	}
+	match.Path = path
+
+	for _, route := range routes {
+		if route.method != method {
+			continue
+		}
+		values := route.regexp.FindStringSubmatch(path)
+		if values == nil {
+			continue
+		}
+		for i, name := range route.regexp.SubexpNames() {
+			if name != "" {
+				match.Params[name] = values[i]
 			}
 		}
+		match.Action = route.action
+		return match
 	}
-	return ActionNone, id
+	return match
 }
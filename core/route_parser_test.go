@@ -1,8 +1,17 @@
 package core
 
 import (
-	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/docker/engine-api/client"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
 )
 
 func TestRouteParser(t *testing.T) {
@@ -11,59 +20,204 @@ func TestRouteParser(t *testing.T) {
 		method         string
 		url            string
 		expectedAction string
+		expectedID     string
 	}{
-		{"GET", "/v1.21/version", ActionDockerVersion},
-		{"POST", "/v1.21/containers/id/wait", ActionContainerWait},
-		{"POST", "/v1.21/containers/id/wait", ActionContainerWait},
-		{"POST", "/v1.21/containers/id/resize", ActionContainerResize},
-		{"POST", "/v1.21/containers/id/stop", ActionContainerStop},
-		{"POST", "/v1.21/containers/id/kill", ActionContainerKill},
-		{"POST", "/v1.21/containers/id/restart", ActionContainerRestart},
-		{"POST", "/v1.21/containers/id/start", ActionContainerStart},
-		{"POST", "/v1.21/containers/id/exec", ActionContainerExecCreate},
-		{"GET", "/v1.21/containers/id/archive", ActionContainerArchive},
-		{"GET", "/v1.21/exec/id/json", ActionContainerExecInspect},
-		{"POST", "/v1.21/exec/id/start", ActionContainerExecStart},
-		{"HEAD", "/v1.21/containers/id/archive", ActionContainerArchiveInfo},
-		{"PUT", "/v1.21/containers/id/archive", ActionContainerArchiveExtract},
-		{"POST", "/v1.21/containers/id/export", ActionContainerExport},
-		{"POST", "/v.1.21/containers/id/attach", ActionContainerAttach},
-		{"GET", "/v.1.21/containers/id/attach/ws", ActionContainerAttachWs},
-		{"GET", "/v.1.21/containers/id/json", ActionContainerInspect},
-		{"POST", "/v.1.21/containers/id/rename", ActionContainerRename},
-		{"POST", "/v.1.21/containers/id/unpause", ActionContainerUnpause},
-		{"GET", "/v.1.21/containers/json", ActionContainerList},
-		{"DELETE", "/v.1.21/containers/id", ActionContainerDelete},
-		{"GET", "/v.1.21/containers/id/stats", ActionContainerStats},
-		{"GET", "/v.1.21/containers/id/changes", ActionContainerChanges},
-		{"GET", "/v.1.21/containers/id/top", ActionContainerTop},
-		{"POST", "/v.1.21/containers/create", ActionContainerCreate},
-		{"GET", "/v.1.21/images/id/get", ActionImageArchive},
-		{"POST", "/v.1.21/images/id/tag", ActionImageTag},
-		{"GET", "/v.1.21/images/id/history", ActionImageHistory},
-		{"POST", "/v.1.21/images/id/push", ActionImagePush},
-		{"POST", "/v.1.21/images/create", ActionImageCreate},
-		{"POST", "/v.1.21/images/load", ActionImageLoad},
-		{"GET", "/v.1.21/images/json", ActionImageList},
-		{"POST", "/v.1.21/images/build", ActionImageBuild},
-		{"GET", "/v.1.21/images/id/json", ActionImageInspect},
-		{"DELETE", "/v.1.21/images/id", ActionImageDelete},
-		{"GET", "/v.1.21/_ping", ActionDockerPing},
-		{"GET", "/v.1.21/info", ActionDockerInfo},
-		{"GET", "/v.1.21/images/search", ActionImagesSearch},
-		{"GET", "/v.1.21/networks", ActionNetworkList},
-		{"GET", "/v.1.21/networks/id", ActionNetworkInspect},
-		{"POST", "/v.1.21/networks/id/disconnect", ActionNetworkDisconnect},
-		{"POST", "/v.1.21/networks/id/connect", ActionNetworkConnect},
-		{"DELETE", "/v.1.21/networks/id", ActionNetworkRemove},
-		{"DELETE", "/v.1.21/volumes/id", ActionVolumeRemove},
-		{"POST", "/v.1.21/volumes/create", ActionVolumeCreate},
-		{"GET", "/v.1.21/volumes/id", ActionVolumeInspect},
-		{"GET", "/v.1.21/volumes", ActionVolumeList},
-		{"GET", "/v.1.21/images/non_existing", ActionNone},
+		{"GET", "/v1.21/version", ActionDockerVersion, ""},
+		{"POST", "/v1.21/containers/id/wait", ActionContainerWait, "id"},
+		{"POST", "/v1.21/containers/id/wait", ActionContainerWait, "id"},
+		{"POST", "/v1.21/containers/id/resize", ActionContainerResize, "id"},
+		{"POST", "/v1.21/containers/id/stop", ActionContainerStop, "id"},
+		{"POST", "/v1.21/containers/id/kill", ActionContainerKill, "id"},
+		{"POST", "/v1.21/containers/id/restart", ActionContainerRestart, "id"},
+		{"POST", "/v1.21/containers/id/start", ActionContainerStart, "id"},
+		{"POST", "/v1.21/containers/id/exec", ActionContainerExecCreate, "id"},
+		{"GET", "/v1.21/containers/id/archive", ActionContainerArchive, "id"},
+		{"GET", "/v1.21/exec/id/json", ActionContainerExecInspect, "id"},
+		{"POST", "/v1.21/exec/id/start", ActionContainerExecStart, "id"},
+		{"HEAD", "/v1.21/containers/id/archive", ActionContainerArchiveInfo, "id"},
+		{"PUT", "/v1.21/containers/id/archive", ActionContainerArchiveExtract, "id"},
+		{"GET", "/v1.21/containers/id/export", ActionContainerExport, "id"},
+		{"POST", "/v.1.21/containers/id/attach", ActionContainerAttach, "id"},
+		{"GET", "/v.1.21/containers/id/attach/ws", ActionContainerAttachWs, "id"},
+		{"GET", "/v.1.21/containers/id/json", ActionContainerInspect, "id"},
+		{"POST", "/v.1.21/containers/id/rename", ActionContainerRename, "id"},
+		{"POST", "/v.1.21/containers/id/unpause", ActionContainerUnpause, "id"},
+		{"GET", "/v.1.21/containers/json", ActionContainerList, ""},
+		{"DELETE", "/v.1.21/containers/id", ActionContainerDelete, "id"},
+		{"GET", "/v.1.21/containers/id/stats", ActionContainerStats, "id"},
+		{"GET", "/v.1.21/containers/id/changes", ActionContainerChanges, "id"},
+		{"GET", "/v.1.21/containers/id/top", ActionContainerTop, "id"},
+		{"POST", "/v.1.21/containers/create", ActionContainerCreate, ""},
+		{"GET", "/v.1.21/images/id/get", ActionImageArchive, "id"},
+		{"POST", "/v.1.21/images/id/tag", ActionImageTag, "id"},
+		{"GET", "/v.1.21/images/id/history", ActionImageHistory, "id"},
+		{"POST", "/v.1.21/images/id/push", ActionImagePush, "id"},
+		{"POST", "/v.1.21/images/create", ActionImageCreate, ""},
+		{"POST", "/v.1.21/images/load", ActionImageLoad, ""},
+		{"GET", "/v.1.21/images/json", ActionImageList, ""},
+		{"POST", "/v.1.21/build", ActionImageBuild, ""},
+		{"GET", "/v.1.21/images/id/json", ActionImageInspect, "id"},
+		{"DELETE", "/v.1.21/images/id", ActionImageDelete, "id"},
+		{"GET", "/v.1.21/_ping", ActionDockerPing, ""},
+		{"GET", "/v.1.21/info", ActionDockerInfo, ""},
+		{"GET", "/v.1.21/images/search", ActionImagesSearch, ""},
+		{"GET", "/v.1.21/networks", ActionNetworkList, ""},
+		{"GET", "/v.1.21/networks/id", ActionNetworkInspect, "id"},
+		{"POST", "/v.1.21/networks/id/disconnect", ActionNetworkDisconnect, "id"},
+		{"POST", "/v.1.21/networks/id/connect", ActionNetworkConnect, "id"},
+		{"DELETE", "/v.1.21/networks/id", ActionNetworkRemove, "id"},
+		{"DELETE", "/v.1.21/volumes/id", ActionVolumeRemove, "id"},
+		{"POST", "/v.1.21/volumes/create", ActionVolumeCreate, ""},
+		{"GET", "/v.1.21/volumes/id", ActionVolumeInspect, "id"},
+		{"GET", "/v.1.21/volumes", ActionVolumeList, ""},
+		{"GET", "/v.1.21/images/non_existing", ActionNone, ""},
+		{"GET", "/v1.24/containers/id/logs?stdout=1&follow=1", ActionContainerLogs, "id"},
+		{"POST", "/containers/create?name=web", ActionContainerCreate, ""},
+		{"GET", "/v1.24/images/myorg/app:1.0/json", ActionImageInspect, "myorg/app:1.0"},
+		{"DELETE", "/v1.24/images/myorg/app:1.0", ActionImageDelete, "myorg/app:1.0"},
+		{"GET", "/v1.24/images/registry:5000/app/get", ActionImageArchive, "registry:5000/app"},
+		{"GET", "/v1.24/events", ActionDockerEvents, ""},
+		{"POST", "/v1.24/services/id/update", ActionServiceUpdate, "id"},
+		{"GET", "/v1.24/services/id", ActionServiceInspect, "id"},
+		{"DELETE", "/v1.24/containers/id/extra", ActionNone, ""},
+		{"GET", "/v1.24/volumes/id/extra", ActionNone, ""},
+		{"GET", "/v1.24/containers/id/json/extra", ActionNone, ""},
+		{"GET", "/v1.24/prefix/containers/json", ActionNone, ""},
+		{"GET", "/v1.24/imagesXget", ActionNone, ""},
+		{"POST", "/v1.24/containers/id/update", ActionContainerUpdate, "id"},
+		{"POST", "/v1.25/containers/prune", ActionContainerPrune, ""},
+		{"POST", "/v1.25/images/prune", ActionImagePrune, ""},
+		{"POST", "/v1.25/volumes/prune", ActionVolumePrune, ""},
+		{"POST", "/v1.25/networks/prune", ActionNetworkPrune, ""},
+		{"GET", "/v1.25/system/df", ActionSystemDataUsage, ""},
+		{"POST", "/v1.24/exec/id/resize?h=24&w=80", ActionContainerExecResize, "id"},
+		{"GET", "/v1.24/images/get?names=busybox", ActionImageArchive, ""},
+		{"POST", "/v1.25/containers/id/checkpoints", ActionContainerCheckpointCreate, "id"},
+		{"GET", "/v1.25/containers/id/checkpoints", ActionContainerCheckpointList, "id"},
+		{"DELETE", "/v1.25/containers/id/checkpoints/cp", ActionContainerCheckpointDelete, "id"},
+		{"GET", "/v1.24/swarm", ActionSwarmInspect, ""},
+		{"POST", "/v1.24/swarm/init", ActionSwarmInit, ""},
+		{"POST", "/v1.24/swarm/join", ActionSwarmJoin, ""},
+		{"POST", "/v1.24/swarm/leave?force=1", ActionSwarmLeave, ""},
+		{"POST", "/v1.24/swarm/update?version=3", ActionSwarmUpdate, ""},
+		{"GET", "/v1.24/nodes", ActionNodeList, ""},
+		{"GET", "/v1.24/nodes/id", ActionNodeInspect, "id"},
+		{"DELETE", "/v1.24/nodes/id", ActionNodeRemove, "id"},
+		{"POST", "/v1.24/nodes/id/update?version=3", ActionNodeUpdate, "id"},
+		{"GET", "/v1.24/services", ActionServiceList, ""},
+		{"DELETE", "/v1.24/services/id", ActionServiceRemove, "id"},
+		{"GET", "/v1.24/tasks", ActionTaskList, ""},
+		{"GET", "/v1.24/tasks/id", ActionTaskInspect, "id"},
+		{"GET", "/v1.24/plugins", ActionPluginList, ""},
+		{"POST", "/v1.24/plugins/pull?name=vieux/sshfs", ActionPluginPull, ""},
+		{"GET", "/v1.24/plugins/vieux/sshfs:latest", ActionPluginInspect, "vieux/sshfs:latest"},
+		{"POST", "/v1.24/plugins/vieux/sshfs/enable", ActionPluginEnable, "vieux/sshfs"},
+		{"POST", "/v1.24/plugins/vieux/sshfs/disable", ActionPluginDisable, "vieux/sshfs"},
+		{"POST", "/v1.25/plugins/vieux/sshfs/set", ActionPluginSet, "vieux/sshfs"},
+		{"POST", "/v1.25/plugins/vieux/sshfs/push", ActionPluginPush, "vieux/sshfs"},
+		{"DELETE", "/v1.24/plugins/vieux/sshfs", ActionPluginRemove, "vieux/sshfs"},
 	}
 
 	for _, test := range tests {
-		assert.Equal(t, test.expectedAction, ParseRoute(test.method, test.url))
+		match := ParseRoute(test.method, test.url)
+		assert.Equal(t, test.expectedAction, match.Action, "%s %s", test.method, test.url)
+		assert.Equal(t, test.expectedID, match.ID(), "%s %s", test.method, test.url)
+	}
+}
+
+func TestRouteMatch(t *testing.T) {
+
+	match := ParseRoute("GET", "/v.1.21/containers/abc/logs?tail=10&stdout=1")
+	assert.Equal(t, ActionContainerLogs, match.Action)
+	assert.Equal(t, "1.21", match.Version)
+	assert.Equal(t, "/containers/abc/logs", match.Path)
+	assert.Equal(t, map[string]string{"id": "abc"}, match.Params)
+	assert.Equal(t, "10", match.Query.Get("tail"))
+
+	match = ParseRoute("POST", "/exec/e1/start")
+	assert.Equal(t, ActionContainerExecStart, match.Action)
+	assert.Equal(t, "", match.Version)
+	assert.Equal(t, "e1", match.Params["execid"])
+
+	tests := []struct {
+		url     string
+		version string
+	}{
+		{"/v1.12/info", "1.12"},
+		{"/v1.24/info", "1.24"},
+		{"/v.1.21/info", "1.21"},
+		{"/info", ""},
+		{"/volumes/v1.2/info", ""},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.version, APIVersion(test.url), test.url)
+	}
+}
+
+// TestClientRoutes calls every method of the vendored engine-api client against a recording server,
+// and checks that every endpoint the client speaks maps to an action
+func TestClientRoutes(t *testing.T) {
+
+	var requests []string
+	called := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	cli, err := client.NewClient("tcp://"+server.Listener.Addr().String(), "1.24", nil, nil)
+	assert.NoError(t, err)
+
+	contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
+	value := reflect.ValueOf(cli)
+	for i := 0; i < value.NumMethod(); i++ {
+		method := value.Type().Method(i)
+		if method.Type.NumIn() < 2 || method.Type.In(1) != contextType {
+			continue
+		}
+		requests = nil
+		callClientMethod(value.Method(i))
+		called += len(requests)
+		for _, request := range requests {
+			parts := strings.SplitN(request, " ", 2)
+			assert.NotEqual(t, ActionNone, ParseRoute(parts[0], parts[1]).Action, "%s: %s", method.Name, request)
+		}
+	}
+	assert.NotZero(t, called)
+}
+
+// callClientMethod calls a client method with placeholder arguments, ignoring its results and panics
+func callClientMethod(method reflect.Value) {
+	defer func() { recover() }()
+	args := make([]reflect.Value, method.Type().NumIn())
+	for i := range args {
+		in := method.Type().In(i)
+		switch {
+		case in.Kind() == reflect.String:
+			args[i] = reflect.ValueOf("id").Convert(in)
+		case i == 0:
+			args[i] = reflect.ValueOf(context.Background())
+		default:
+			args[i] = reflect.Zero(in)
+		}
+	}
+	for _, result := range method.Call(args) {
+		if closer, ok := result.Interface().(io.Closer); ok && !result.IsNil() {
+			closer.Close()
+		}
+	}
+}
+
+func TestActions(t *testing.T) {
+	actions := Actions()
+	assert.True(t, sort.StringsAreSorted(actions))
+	assert.Contains(t, actions, ActionContainerCreate)
+	assert.Contains(t, actions, ActionServiceCreate)
+	seen := make(map[string]bool)
+	for _, action := range actions {
+		assert.False(t, seen[action], "duplicate action %s", action)
+		seen[action] = true
 	}
 }
@@ -7,11 +7,14 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/authorization"
 	"github.com/docker/docker/pkg/plugins"
 	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -19,25 +22,67 @@ const (
 	pluginFolder = "/run/docker/plugins"
 )
 
-//ID2TenantMap - Keep track about resource ownership
+// authorizationTimeout bounds the time an authorizer may take to decide, past it the request fails with an error
+var authorizationTimeout = 10 * time.Second
+
+// AdminPathPrefix is the path administrative queries are served under on the plugin socket
+const AdminPathPrefix = "/admin"
+
+// PluginSocketPath is the unix socket the authorization server listens on
+var PluginSocketPath = fmt.Sprintf("%s/%s.sock", pluginFolder, pluginName)
+
+// ID2TenantMap - Keep track about resource ownership
 var ID2TenantMap map[string]string
 
-//Name2TIDMap - Keep track about resource ownership
+// Name2TIDMap - Keep track about resource ownership
 var Name2TIDMap map[string]string
 
+// tenantMutex guards the resource ownership maps
+var tenantMutex sync.RWMutex
+
+// SetResourceTenant records the tenant owning the given resource id
+func SetResourceTenant(id, tenant string) {
+	tenantMutex.Lock()
+	defer tenantMutex.Unlock()
+	if ID2TenantMap == nil {
+		ID2TenantMap = make(map[string]string)
+	}
+	ID2TenantMap[id] = tenant
+}
+
+// ResourceTenant returns the tenant owning the given resource id, or an empty string if unknown
+func ResourceTenant(id string) string {
+	tenantMutex.RLock()
+	defer tenantMutex.RUnlock()
+	return ID2TenantMap[id]
+}
+
+// RemoveResourceTenant forgets the tenant owning the given resource id
+func RemoveResourceTenant(id string) {
+	tenantMutex.Lock()
+	defer tenantMutex.Unlock()
+	delete(ID2TenantMap, id)
+}
+
 // AuthZSrv implements the authz plugin specification on top of unix sockets
 // the authZSrv uses two core components to manage the flow, the authorizer,
 // which is used to perform the actual authorization.
 type AuthZSrv struct {
-	authorizer Authorizer   // authorizer is the concrete handler for plugins
+	authorizer AuthorizerV2 // authorizer is the concrete handler for plugins
+	auditor    Auditor      // auditor writes the audit trail of the decisions, nil for none
 	listener   net.Listener // listener is the plugin socket listener
 }
 
 // NewAuthZSrv creates a new authorization server
-func NewAuthZSrv(plugin Authorizer) *AuthZSrv {
+func NewAuthZSrv(plugin AuthorizerV2) *AuthZSrv {
 	return &AuthZSrv{authorizer: plugin}
 }
 
+// SetAuditor sets the auditor the decisions are written to
+func (a *AuthZSrv) SetAuditor(auditor Auditor) {
+	a.auditor = auditor
+}
+
 // Start starts the authorization server
 func (a *AuthZSrv) Start() error {
 	err := a.authorizer.Init()
@@ -46,6 +91,12 @@ func (a *AuthZSrv) Start() error {
 		return err
 	}
 
+	if a.auditor != nil {
+		if err := a.auditor.Init(); err != nil {
+			return err
+		}
+	}
+
 	if _, err := os.Stat(pluginFolder); os.IsNotExist(err) {
 		logrus.Infof("Creating plugins folder %q", pluginName)
 		err = os.MkdirAll("/run/docker/plugins/", 0750)
@@ -54,10 +105,8 @@ func (a *AuthZSrv) Start() error {
 		}
 	}
 
-	pluginPath := fmt.Sprintf("%s/%s.sock", pluginFolder, pluginName)
-
-	os.Remove(pluginPath)
-	a.listener, err = net.ListenUnix("unix", &net.UnixAddr{Name: pluginPath, Net: "unix"})
+	os.Remove(PluginSocketPath)
+	a.listener, err = net.ListenUnix("unix", &net.UnixAddr{Name: PluginSocketPath, Net: "unix"})
 	if err != nil {
 		return err
 	}
@@ -91,13 +140,10 @@ func (a *AuthZSrv) Start() error {
 			return
 		}
 
-		authZRes := a.authorizer.AuthZReq(&authReq)
-
-		if authZRes != nil {
-			logrus.Debugf(authZRes.Msg)
-		}
+		decision := a.audited(AuditPhaseRequest, NewRequestContext(&authReq), a.authorizer.AuthorizeRequest)
+		logrus.Debugf("Request %s %s: %s %s", authReq.RequestMethod, authReq.RequestURI, decision.Result, decision.Message)
 
-		writeResponse(w, authZRes)
+		writeResponse(w, decision.Response())
 	})
 
 	router.HandleFunc(fmt.Sprintf("/%s", authorization.AuthZApiResponse), func(w http.ResponseWriter, r *http.Request) {
@@ -118,16 +164,93 @@ func (a *AuthZSrv) Start() error {
 			return
 		}
 
-		authZRes := a.authorizer.AuthZRes(&authReq)
+		decision := a.audited(AuditPhaseResponse, NewRequestContext(&authReq), a.authorizer.AuthorizeResponse)
 
-		writeResponse(w, authZRes)
+		writeResponse(w, decision.Response())
 	})
+	if admin, ok := a.authorizer.(AdminHandler); ok {
+		for name, handler := range admin.AdminRoutes() {
+			router.HandleFunc(fmt.Sprintf("%s/%s", AdminPathPrefix, name), handler).Methods("GET")
+		}
+	}
+
+	tenantMutex.Lock()
 	ID2TenantMap = make(map[string]string)
 	Name2TIDMap = make(map[string]string)
+	tenantMutex.Unlock()
 	logrus.Info("Initialized authorization server")
 	return http.Serve(a.listener, router)
 }
 
+// audited runs an authorization, records its metrics and writes its audit record, with the ledger state
+// before and after it
+func (a *AuthZSrv) audited(phase string, req *RequestContext, authorizer func(context.Context, *RequestContext) Decision) Decision {
+	start := time.Now()
+	if a.auditor == nil {
+		decision := authorize(req, authorizer)
+		observeDecision(phase, req, decision, time.Since(start))
+		return decision
+	}
+	record := newAuditRecord(phase, req, start)
+	record.LedgerBefore = ledgerState(a.authorizer, req.Tenant)
+	decision := authorize(req, authorizer)
+	latency := time.Since(start)
+	observeDecision(phase, req, decision, latency)
+	record.LatencyMs = float64(latency) / float64(time.Millisecond)
+	record.LedgerAfter = ledgerState(a.authorizer, req.Tenant)
+	record.Decision = decision.Result
+	record.Reason = decision.Reason
+	record.Message = decision.Message
+	record.Rule = decision.Rule
+	record.Authorizer = decision.Authorizer
+	record.ResponseStatus = req.ResponseStatusCode
+	if err := a.auditor.Audit(record); err != nil {
+		logrus.Errorf("Failed to audit %s %s: %v", req.RequestMethod, req.RequestURI, err)
+	}
+	return decision
+}
+
+// authorize runs an authorization with a deadline, an authorizer missing it yields an error decision.
+// The authorizer keeps running until it notices the context is done, a decision reached in the meantime
+// is discarded, authorizers must not mutate their state past the deadline. An admission racing the deadline
+// is left pending and dropped by the next reconciliation of the authorizer with the daemon
+func authorize(req *RequestContext, authorizer func(context.Context, *RequestContext) Decision) Decision {
+	ctx, cancel := context.WithTimeout(context.Background(), authorizationTimeout)
+	defer cancel()
+
+	decisions := make(chan Decision, 1)
+	go func() {
+		defer func() {
+			// the server no longer runs the authorizer in the request goroutine recovered by net/http
+			if r := recover(); r != nil {
+				logrus.Errorf("Authorizer panicked on %s %s: %v", req.RequestMethod, req.RequestURI, r)
+				decisions <- Decision{
+					Result:  DecisionError,
+					Reason:  ReasonError,
+					Message: fmt.Sprintf("Authorization of %s %s failed: %v", req.RequestMethod, req.RequestURI, r),
+				}
+			}
+		}()
+		decisions <- authorizer(ctx, req)
+	}()
+	select {
+	case decision := <-decisions:
+		return decision
+	case <-ctx.Done():
+		select {
+		case decision := <-decisions:
+			// decided right at the deadline, the authorizer may have acted on it
+			return decision
+		default:
+		}
+		return Decision{
+			Result:  DecisionError,
+			Reason:  ReasonTimeout,
+			Message: fmt.Sprintf("Authorization of %s %s timed out", req.RequestMethod, req.RequestURI),
+		}
+	}
+}
+
 // Stop stops the authorization server
 func (a *AuthZSrv) Stop() {
 
@@ -117,6 +117,69 @@ var (
 	ActionServiceInspect = "service_inspect"
 	// ActionServiceUpdate describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/update-a-service
 	ActionServiceUpdate = "service_update"
+
+	// ActionContainerUpdate describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/update-a-container
+	ActionContainerUpdate = "container_update"
+	// ActionContainerPrune describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/delete-stopped-containers
+	ActionContainerPrune = "container_prune"
+	// ActionContainerCheckpointCreate describes https://github.com/docker/docker/blob/master/experimental/checkpoint-restore.md
+	ActionContainerCheckpointCreate = "container_checkpoint_create"
+	// ActionContainerCheckpointList describes https://github.com/docker/docker/blob/master/experimental/checkpoint-restore.md
+	ActionContainerCheckpointList = "container_checkpoint_list"
+	// ActionContainerCheckpointDelete describes https://github.com/docker/docker/blob/master/experimental/checkpoint-restore.md
+	ActionContainerCheckpointDelete = "container_checkpoint_delete"
+	// ActionContainerExecResize describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/exec-resize
+	ActionContainerExecResize = "container_exec_resize"
+	// ActionImagePrune describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/delete-unused-images
+	ActionImagePrune = "image_prune"
+	// ActionVolumePrune describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/delete-unused-volumes
+	ActionVolumePrune = "volume_prune"
+	// ActionNetworkPrune describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/delete-unused-networks
+	ActionNetworkPrune = "network_prune"
+	// ActionSystemDataUsage describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/show-docker-data-usage-information
+	ActionSystemDataUsage = "system_df"
+	// ActionSwarmInspect describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/inspect-swarm
+	ActionSwarmInspect = "swarm_inspect"
+	// ActionSwarmInit describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/initialize-a-new-swarm
+	ActionSwarmInit = "swarm_init"
+	// ActionSwarmJoin describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/join-an-existing-swarm
+	ActionSwarmJoin = "swarm_join"
+	// ActionSwarmLeave describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/leave-a-swarm
+	ActionSwarmLeave = "swarm_leave"
+	// ActionSwarmUpdate describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/update-a-swarm
+	ActionSwarmUpdate = "swarm_update"
+	// ActionNodeList describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/list-nodes
+	ActionNodeList = "node_list"
+	// ActionNodeInspect describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/inspect-a-node
+	ActionNodeInspect = "node_inspect"
+	// ActionNodeRemove describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/remove-a-node
+	ActionNodeRemove = "node_remove"
+	// ActionNodeUpdate describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/update-a-node
+	ActionNodeUpdate = "node_update"
+	// ActionServiceList describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/list-services
+	ActionServiceList = "service_list"
+	// ActionServiceRemove describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/remove-a-service
+	ActionServiceRemove = "service_remove"
+	// ActionTaskList describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/list-tasks
+	ActionTaskList = "task_list"
+	// ActionTaskInspect describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/inspect-a-task
+	ActionTaskInspect = "task_inspect"
+	// ActionPluginList describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/list-plugins
+	ActionPluginList = "plugin_list"
+	// ActionPluginInspect describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/inspect-a-plugin
+	ActionPluginInspect = "plugin_inspect"
+	// ActionPluginPull describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/install-a-plugin
+	ActionPluginPull = "plugin_pull"
+	// ActionPluginEnable describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/enable-a-plugin
+	ActionPluginEnable = "plugin_enable"
+	// ActionPluginDisable describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/disable-a-plugin
+	ActionPluginDisable = "plugin_disable"
+	// ActionPluginSet describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/configure-a-plugin
+	ActionPluginSet = "plugin_set"
+	// ActionPluginPush describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.25/#/push-a-plugin
+	ActionPluginPush = "plugin_push"
+	// ActionPluginRemove describes https://docs.docker.com/engine/reference/api/docker_remote_api_v1.24/#/remove-a-plugin
+	ActionPluginRemove = "plugin_remove"
 	// ActionNone indicates no action matched the given method URL combination
 	ActionNone = ""
 )
@@ -0,0 +1,15 @@
+package core
+
+import "regexp"
+
+// versionPrefix matches the API version prefixing a request path, the daemon also accepts "/v.1.21/"
+var versionPrefix = regexp.MustCompile(`^/v\.?([0-9]+(?:\.[0-9]+)*)/`)
+
+// APIVersion returns the docker API version prefixing the url (e.g. "1.21" for "/v1.21/info" and "/v.1.21/info"),
+// or an empty string for unversioned requests, which the daemon serves with its latest API version
+func APIVersion(url string) string {
+	if match := versionPrefix.FindStringSubmatch(url); match != nil {
+		return match[1]
+	}
+	return ""
+}
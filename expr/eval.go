@@ -0,0 +1,282 @@
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// node is a node of the syntax tree of an expression
+type node interface {
+	eval(resolver Resolver) (interface{}, error)
+	position() int
+}
+
+// literal is a constant
+type literal struct {
+	value interface{}
+	pos   int
+}
+
+// variable is a value provided by the resolver
+type variable struct {
+	path []string
+	pos  int
+}
+
+// list is a list literal
+type list struct {
+	items []node
+	pos   int
+}
+
+// unary is a prefix operator
+type unary struct {
+	op      string
+	operand node
+	pos     int
+}
+
+// binary is an infix operator
+type binary struct {
+	op          string
+	left, right node
+	pos         int
+}
+
+func (n *literal) position() int  { return n.pos }
+func (n *variable) position() int { return n.pos }
+func (n *list) position() int     { return n.pos }
+func (n *unary) position() int    { return n.pos }
+func (n *binary) position() int   { return n.pos }
+
+func (n *literal) eval(resolver Resolver) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *variable) eval(resolver Resolver) (interface{}, error) {
+	value, err := resolver.Lookup(n.path)
+	if err != nil {
+		return nil, &Error{Pos: n.pos, Msg: err.Error()}
+	}
+	return normalize(value), nil
+}
+
+func (n *list) eval(resolver Resolver) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(resolver)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (n *unary) eval(resolver Resolver) (interface{}, error) {
+	value, err := n.operand.eval(resolver)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, err := truth(value, n.operand.position())
+		return !b, err
+	}
+	number, ok := value.(float64)
+	if !ok {
+		return nil, &Error{Pos: n.pos, Msg: fmt.Sprintf("cannot negate %s", typeName(value))}
+	}
+	return -number, nil
+}
+
+func (n *binary) eval(resolver Resolver) (interface{}, error) {
+	left, err := n.left.eval(resolver)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "&&", "||":
+		b, err := truth(left, n.left.position())
+		if err != nil || b == (n.op == "||") {
+			return b, err
+		}
+		right, err := n.right.eval(resolver)
+		if err != nil {
+			return nil, err
+		}
+		return truth(right, n.right.position())
+	}
+	right, err := n.right.eval(resolver)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "in":
+		return n.contains(right, left)
+	case "<", "<=", ">", ">=":
+		return n.compare(left, right)
+	}
+	return n.arithmetic(left, right)
+}
+
+// contains implements the in operator on lists, objects (keys) and strings (substrings)
+func (n *binary) contains(container, value interface{}) (interface{}, error) {
+	switch container := container.(type) {
+	case []interface{}:
+		for _, item := range container {
+			if reflect.DeepEqual(item, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := value.(string)
+		if !ok {
+			return false, nil
+		}
+		_, found := container[key]
+		return found, nil
+	case string:
+		s, ok := value.(string)
+		return ok && strings.Contains(container, s), nil
+	case nil:
+		return false, nil
+	}
+	return nil, &Error{Pos: n.pos, Msg: fmt.Sprintf("cannot search in %s", typeName(container))}
+}
+
+// compare implements the ordering operators on numbers and strings
+func (n *binary) compare(left, right interface{}) (interface{}, error) {
+	var order int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, n.mismatch(left, right)
+		}
+		switch {
+		case l < r:
+			order = -1
+		case l > r:
+			order = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, n.mismatch(left, right)
+		}
+		order = strings.Compare(l, r)
+	default:
+		return nil, n.mismatch(left, right)
+	}
+	switch n.op {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	}
+	return order >= 0, nil
+}
+
+// arithmetic implements +, -, * and / on numbers and + on strings
+func (n *binary) arithmetic(left, right interface{}) (interface{}, error) {
+	if l, ok := left.(string); ok && n.op == "+" {
+		if r, ok := right.(string); ok {
+			return l + r, nil
+		}
+	}
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, n.mismatch(left, right)
+	}
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	}
+	if r == 0 {
+		return nil, &Error{Pos: n.pos, Msg: "division by zero"}
+	}
+	return l / r, nil
+}
+
+// mismatch returns the error of an operator applied to unsupported operands
+func (n *binary) mismatch(left, right interface{}) error {
+	return &Error{Pos: n.pos, Msg: fmt.Sprintf("cannot apply %s to %s and %s", n.op, typeName(left), typeName(right))}
+}
+
+// truth converts a value to a condition, null is false
+func truth(value interface{}, pos int) (bool, error) {
+	switch value := value.(type) {
+	case bool:
+		return value, nil
+	case nil:
+		return false, nil
+	}
+	return false, &Error{Pos: pos, Msg: fmt.Sprintf("expected a boolean, found %s", typeName(value))}
+}
+
+// typeName names the type of a value in error messages
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// normalize converts the values of resolvers to the types of the language
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, float64, string, []interface{}, map[string]interface{}:
+		return value
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, s := range v {
+			values[i] = s
+		}
+		return values
+	case map[string]string:
+		values := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			values[k] = s
+		}
+		return values
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		return normalize(rv.Elem().Interface())
+	}
+	return value
+}
@@ -0,0 +1,100 @@
+// Package expr implements the small expression language of policy rules, e.g.
+//
+//	action == "container_create" && body.HostConfig.Privileged && tenant != "infra"
+//
+// Expressions combine literals (strings, numbers with optional k/m/g/t size suffixes, true, false, null and lists)
+// and variables (dotted paths such as body.HostConfig.Memory or labels["com.example.team"]) with the operators
+// ||, &&, !, ==, !=, <, <=, >, >=, in, +, -, * and /.
+package expr
+
+import (
+	"fmt"
+)
+
+// Error is a compilation or evaluation error located in the expression source
+type Error struct {
+	Pos int    // Pos is the 1-based column of the error
+	Msg string // Msg describes the error
+}
+
+// Error formats the error with its column
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Pos)
+}
+
+// Resolver provides the values of the variables of an expression
+type Resolver interface {
+	// Validate returns an error if the variable path is unknown, it is called once at compilation
+	Validate(path []string) error
+	// Lookup returns the value of a variable path, nil if it is unset
+	Lookup(path []string) (interface{}, error)
+}
+
+// Expr is a compiled expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses an expression and validates its variables
+func Compile(src string, resolver Resolver) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, &Error{Pos: next.pos, Msg: fmt.Sprintf("unexpected %s", next)}
+	}
+	if err := validate(root, resolver); err != nil {
+		return nil, err
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression, numbers are float64, lists []interface{} and objects map[string]interface{}
+func (e *Expr) Eval(resolver Resolver) (interface{}, error) {
+	return e.root.eval(resolver)
+}
+
+// Bool evaluates the expression as a condition, null is false and any other non boolean value is an error
+func (e *Expr) Bool(resolver Resolver) (bool, error) {
+	value, err := e.root.eval(resolver)
+	if err != nil {
+		return false, err
+	}
+	return truth(value, e.root.position())
+}
+
+// validate checks every variable of the expression against the resolver
+func validate(n node, resolver Resolver) error {
+	switch n := n.(type) {
+	case *variable:
+		if err := resolver.Validate(n.path); err != nil {
+			return &Error{Pos: n.pos, Msg: err.Error()}
+		}
+	case *unary:
+		return validate(n.operand, resolver)
+	case *binary:
+		if err := validate(n.left, resolver); err != nil {
+			return err
+		}
+		return validate(n.right, resolver)
+	case *list:
+		for _, item := range n.items {
+			if err := validate(item, resolver); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
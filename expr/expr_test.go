@@ -0,0 +1,115 @@
+package expr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testResolver resolves variables from a nested map
+type testResolver map[string]interface{}
+
+func (r testResolver) Validate(path []string) error {
+	if _, ok := r[path[0]]; !ok {
+		return fmt.Errorf("unknown variable %s", path[0])
+	}
+	return nil
+}
+
+func (r testResolver) Lookup(path []string) (interface{}, error) {
+	var value interface{} = map[string]interface{}(r)
+	for _, name := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		value = object[name]
+	}
+	return value, nil
+}
+
+func TestExpr(t *testing.T) {
+
+	resolver := testResolver{
+		"action": "container_create",
+		"tenant": "team-a",
+		"used":   int64(3 << 30),
+		"body": map[string]interface{}{
+			"HostConfig": map[string]interface{}{"Privileged": true, "Memory": float64(1 << 30)},
+		},
+		"labels": map[string]interface{}{"com.example.pci": "true"},
+	}
+
+	tests := []struct {
+		expr   string
+		result interface{}
+	}{
+		{`action == "container_create" && body.HostConfig.Privileged && tenant != "infra"`, true},
+		{`action == "container_create" && !body.HostConfig.Privileged`, false},
+		{`body.HostConfig.Missing`, nil},
+		{`!body.HostConfig.Missing`, true},
+		{`used + body.HostConfig.Memory > 3g`, true},
+		{`used + body.HostConfig.Memory <= 4g`, true},
+		{`used / 1g`, float64(3)},
+		{`-used < 0`, true},
+		{`2 + 3 * 4`, float64(14)},
+		{`(2 + 3) * 4`, float64(20)},
+		{`512m`, float64(512 << 20)},
+		{`tenant in ["team-a", "team-b"]`, true},
+		{`"pci" in tenant`, false},
+		{`"com.example.pci" in labels`, true},
+		{`labels["com.example.pci"] == "true"`, true},
+		{`tenant + "/" + action`, "team-a/container_create"},
+		{`tenant < "team-b"`, true},
+		{`false || null || tenant == "team-a"`, true},
+		{`false && body.HostConfig.Memory`, false},
+		{`[1, "a", null]`, []interface{}{float64(1), "a", nil}},
+	}
+
+	for _, test := range tests {
+		e, err := Compile(test.expr, resolver)
+		if !assert.NoError(t, err, test.expr) {
+			continue
+		}
+		result, err := e.Eval(resolver)
+		assert.NoError(t, err, test.expr)
+		assert.Equal(t, test.result, result, test.expr)
+	}
+
+	errors := []struct {
+		expr string
+		err  string
+	}{
+		{`action ==`, `unexpected end of expression at column 10`},
+		{`action == "create`, `unterminated string at column 11`},
+		{`tenant == "a" )`, `unexpected ")" at column 15`},
+		{`owner == "a"`, `unknown variable owner at column 1`},
+		{`action = "a"`, `unexpected character '=' at column 8`},
+		{`used > 4x`, `invalid number "4x" at column 8`},
+		{`labels[pci]`, `expected a quoted field name, found "pci" at column 8`},
+		{`[1, 2`, `expected ",", found end of expression at column 6`},
+	}
+
+	for _, test := range errors {
+		_, err := Compile(test.expr, resolver)
+		assert.EqualError(t, err, test.err, test.expr)
+	}
+
+	runtime := []struct {
+		expr string
+		err  string
+	}{
+		{`tenant && true`, `expected a boolean, found string at column 1`},
+		{`tenant > 1`, `cannot apply > to string and number at column 8`},
+		{`used / 0`, `division by zero at column 6`},
+	}
+
+	for _, test := range runtime {
+		e, err := Compile(test.expr, resolver)
+		if assert.NoError(t, err, test.expr) {
+			_, err = e.Bool(resolver)
+			assert.EqualError(t, err, test.err, test.expr)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tokenKind is the kind of a lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+// token is a lexical token of an expression
+type token struct {
+	kind   tokenKind
+	text   string  // text is the source of the token, the unquoted value for strings
+	number float64 // number is the value of number tokens
+	pos    int     // pos is the 1-based column the token starts at
+}
+
+// String describes the token in error messages
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators are the operators of the language, longest first so that "<=" is not lexed as "<"
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")", "[", "]", ",", "."}
+
+// sizeSuffixes are the multipliers of memory size literals (e.g. 512m, 2g)
+var sizeSuffixes = map[string]float64{
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+// lex splits an expression into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, &Error{Pos: i + 1, Msg: "unterminated string"}
+			}
+			value, err := strconv.Unquote(src[i : end+1])
+			if err != nil {
+				return nil, &Error{Pos: i + 1, Msg: fmt.Sprintf("invalid string %s", src[i:end+1])}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: value, pos: i + 1})
+			i = end + 1
+		case unicode.IsDigit(c):
+			end := i
+			for end < len(src) && (unicode.IsDigit(rune(src[end])) || src[end] == '.') {
+				end++
+			}
+			number, err := strconv.ParseFloat(src[i:end], 64)
+			if err != nil {
+				return nil, &Error{Pos: i + 1, Msg: fmt.Sprintf("invalid number %q", src[i:end])}
+			}
+			if end < len(src) {
+				if multiplier, ok := sizeSuffixes[strings.ToLower(src[end:end+1])]; ok && (end+1 == len(src) || !isIdentRune(rune(src[end+1]))) {
+					number *= multiplier
+					end++
+				}
+			}
+			if end < len(src) && isIdentRune(rune(src[end])) {
+				return nil, &Error{Pos: i + 1, Msg: fmt.Sprintf("invalid number %q", src[i:end+1])}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[i:end], number: number, pos: i + 1})
+			i = end
+		case isIdentRune(c):
+			end := i
+			for end < len(src) && (isIdentRune(rune(src[end])) || unicode.IsDigit(rune(src[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[i:end], pos: i + 1})
+			i = end
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i + 1})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &Error{Pos: i + 1, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src) + 1}), nil
+}
+
+// isIdentRune returns whether the rune may start an identifier
+func isIdentRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c)
+}
@@ -0,0 +1,239 @@
+package expr
+
+import (
+	"fmt"
+)
+
+// parser is a recursive descent parser over the tokens of an expression
+type parser struct {
+	tokens []token
+	next   int
+}
+
+// peek returns the next token without consuming it
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+// take consumes the next token
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators or keywords
+func (p *parser) accept(texts ...string) (token, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator && t.kind != tokenIdent {
+		return t, false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			return p.take(), true
+		}
+	}
+	return t, false
+}
+
+// expect consumes the next token, which must be the operator
+func (p *parser) expect(text string) (token, error) {
+	t, ok := p.accept(text)
+	if !ok {
+		return t, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected %q, found %s", text, t)}
+	}
+	return t, nil
+}
+
+// parseOr parses a || b
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("||")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op.text, left: left, right: right, pos: op.pos}
+	}
+}
+
+// parseAnd parses a && b
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("&&")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op.text, left: left, right: right, pos: op.pos}
+	}
+}
+
+// parseComparison parses a single comparison, comparisons do not chain
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	return &binary{op: op.text, left: left, right: right, pos: op.pos}, nil
+}
+
+// parseSum parses a + b and a - b
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op.text, left: left, right: right, pos: op.pos}
+	}
+}
+
+// parseProduct parses a * b and a / b
+func (p *parser) parseProduct() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op.text, left: left, right: right, pos: op.pos}
+	}
+}
+
+// parseUnary parses !a and -a
+func (p *parser) parseUnary() (node, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{op: op.text, operand: operand, pos: op.pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses literals, variables, lists and parenthesized expressions
+func (p *parser) parsePrimary() (node, error) {
+	t := p.take()
+	switch t.kind {
+	case tokenNumber:
+		return &literal{value: t.number, pos: t.pos}, nil
+	case tokenString:
+		return &literal{value: t.text, pos: t.pos}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literal{value: true, pos: t.pos}, nil
+		case "false":
+			return &literal{value: false, pos: t.pos}, nil
+		case "null":
+			return &literal{value: nil, pos: t.pos}, nil
+		case "in":
+			return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+		}
+		return p.parseVariable(t)
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			return p.parseList(t)
+		}
+	}
+	return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+}
+
+// parseVariable parses the rest of a variable path, made of .name and ["name"] segments
+func (p *parser) parseVariable(first token) (node, error) {
+	v := &variable{path: []string{first.text}, pos: first.pos}
+	for {
+		if _, ok := p.accept("."); ok {
+			name := p.take()
+			if name.kind != tokenIdent {
+				return nil, &Error{Pos: name.pos, Msg: fmt.Sprintf("expected a field name, found %s", name)}
+			}
+			v.path = append(v.path, name.text)
+			continue
+		}
+		if _, ok := p.accept("["); ok {
+			name := p.take()
+			if name.kind != tokenString {
+				return nil, &Error{Pos: name.pos, Msg: fmt.Sprintf("expected a quoted field name, found %s", name)}
+			}
+			if _, err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			v.path = append(v.path, name.text)
+			continue
+		}
+		return v, nil
+	}
+}
+
+// parseList parses the items of a list literal after its opening bracket
+func (p *parser) parseList(open token) (node, error) {
+	l := &list{pos: open.pos}
+	if _, ok := p.accept("]"); ok {
+		return l, nil
+	}
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		l.items = append(l.items, item)
+		if _, ok := p.accept("]"); ok {
+			return l, nil
+		}
+		if _, err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,429 @@
+// Package metrics exposes counters, gauges and histograms in the Prometheus text exposition format, e.g.
+//
+//	# HELP authz_broker_decisions_total Authorization decisions by phase, action and result.
+//	# TYPE authz_broker_decisions_total counter
+//	authz_broker_decisions_total{phase="request",action="container_create",result="allow"} 12
+//
+// Metrics are registered once, usually in package variables, and are safe for concurrent use.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// contentType is the media type of the text exposition format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultLatencyBuckets are the upper bounds in seconds of latency histograms, from half a millisecond to ten seconds
+var DefaultLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric is a named metric written to the exposition
+type metric interface {
+	// name returns the name of the metric
+	name() string
+	// write writes the metric help, type and samples
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics and writes them sorted by name
+type Registry struct {
+	sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// DefaultRegistry is the registry of the package level constructors and of the metrics listener
+var DefaultRegistry = NewRegistry()
+
+// register adds a metric, registering the same name twice is a programming error
+func (r *Registry) register(m metric) {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.metrics[m.name()]; ok {
+		panic(fmt.Sprintf("Metric %s registered twice", m.name()))
+	}
+	r.metrics[m.name()] = m
+}
+
+// WriteText writes every metric in the text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]metric, len(names))
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	r.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(buf)
+	}
+	return buf.Flush()
+}
+
+// ServeHTTP serves the metrics in the text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	if err := r.WriteText(w); err != nil {
+		logrus.Errorf("Failed to write metrics: %v", err)
+	}
+}
+
+// Serve listens on the given address and serves the metrics of the default registry on /metrics in the
+// background, it returns once listening
+func Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", DefaultRegistry)
+	logrus.Infof("Serving metrics on %s/metrics", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logrus.Errorf("Metrics listener stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// desc is the name, help and label names shared by every metric type
+type desc struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+}
+
+// name returns the name of the metric
+func (d *desc) name() string {
+	return d.metricName
+}
+
+// key checks the label values match the label names and returns the key of their series
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("Metric %s expects %d label values, got %d", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// writeHeader writes the help and type lines
+func (d *desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.metricName, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.metricName, d.kind)
+}
+
+// writeSample writes a sample line, extra is appended to the label pairs (e.g. the histogram bucket bound)
+func (d *desc) writeSample(w *bufio.Writer, suffix string, values []string, extra string, value float64) {
+	w.WriteString(d.metricName)
+	w.WriteString(suffix)
+	var pairs []string
+	for i, label := range d.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", label, escapeLabel(values[i])))
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatValue(value) + "\n")
+}
+
+// series is the value of a metric for a combination of label values
+type series struct {
+	values []string
+	value  float64
+}
+
+// valueSet is the series of a counter or gauge
+type valueSet struct {
+	sync.Mutex
+	desc
+	series map[string]*series
+}
+
+// get returns the series of the label values, creating it if needed, with the lock held
+func (s *valueSet) get(values []string) *series {
+	key := s.key(values)
+	v, ok := s.series[key]
+	if !ok {
+		v = &series{values: append([]string(nil), values...)}
+		s.series[key] = v
+	}
+	return v
+}
+
+// lookup returns the value of the label values, zero if unset
+func (s *valueSet) lookup(values []string) float64 {
+	if v, ok := s.series[s.key(values)]; ok {
+		return v.value
+	}
+	return 0
+}
+
+// newValueSet creates the series of a counter or gauge, metrics without labels start with a zero value
+func newValueSet(name, help, kind string, labels []string) *valueSet {
+	s := &valueSet{desc: desc{name, help, kind, labels}, series: make(map[string]*series)}
+	if len(labels) == 0 {
+		s.get(nil)
+	}
+	return s
+}
+
+// write writes the series sorted by label values
+func (s *valueSet) write(w *bufio.Writer) {
+	s.Lock()
+	defer s.Unlock()
+	s.writeHeader(w)
+	for _, key := range sortedKeys(s.series) {
+		v := s.series[key]
+		s.writeSample(w, "", v.values, "", v.value)
+	}
+}
+
+// Counter is a monotonically increasing value by label values
+type Counter struct {
+	*valueSet
+}
+
+// NewCounter registers a counter in the default registry
+func NewCounter(name, help string, labels ...string) *Counter {
+	return DefaultRegistry.NewCounter(name, help, labels...)
+}
+
+// NewCounter registers a counter
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newValueSet(name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds a non negative delta to the counter of the label values
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("Counter %s cannot decrease", c.metricName))
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.get(values).value += delta
+}
+
+// Value returns the counter of the label values
+func (c *Counter) Value(values ...string) float64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.lookup(values)
+}
+
+// Gauge is a value that goes up and down by label values
+type Gauge struct {
+	*valueSet
+}
+
+// NewGauge registers a gauge in the default registry
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return DefaultRegistry.NewGauge(name, help, labels...)
+}
+
+// NewGauge registers a gauge
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newValueSet(name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge of the label values
+func (g *Gauge) Set(value float64, values ...string) {
+	g.Lock()
+	defer g.Unlock()
+	g.get(values).value = value
+}
+
+// Value returns the gauge of the label values
+func (g *Gauge) Value(values ...string) float64 {
+	g.Lock()
+	defer g.Unlock()
+	return g.lookup(values)
+}
+
+// GaugeFunc is a gauge whose series are collected when the metrics are written
+type GaugeFunc struct {
+	desc
+	collect func(emit func(value float64, values ...string))
+}
+
+// NewGaugeFunc registers a collected gauge in the default registry
+func NewGaugeFunc(name, help string, collect func(emit func(value float64, values ...string)), labels ...string) *GaugeFunc {
+	return DefaultRegistry.NewGaugeFunc(name, help, collect, labels...)
+}
+
+// NewGaugeFunc registers a collected gauge, collect emits the value of every combination of label values
+func (r *Registry) NewGaugeFunc(name, help string, collect func(emit func(value float64, values ...string)), labels ...string) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name, help, "gauge", labels}, collect: collect}
+	r.register(g)
+	return g
+}
+
+// write collects and writes the series sorted by label values
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	collected := make(map[string]*series)
+	g.collect(func(value float64, values ...string) {
+		collected[g.key(values)] = &series{values: values, value: value}
+	})
+	g.writeHeader(w)
+	for _, key := range sortedKeys(collected) {
+		s := collected[key]
+		g.writeSample(w, "", s.values, "", s.value)
+	}
+}
+
+// histogramSeries is the distribution of the observations of a combination of label values
+type histogramSeries struct {
+	values []string
+	counts []uint64 // counts are the observations per bucket, not cumulative, the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations in buckets by label values
+type Histogram struct {
+	sync.Mutex
+	desc
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+// NewHistogram registers a histogram in the default registry
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return DefaultRegistry.NewHistogram(name, help, buckets, labels...)
+}
+
+// NewHistogram registers a histogram with the given sorted bucket upper bounds
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("Histogram %s buckets are not sorted", name))
+	}
+	h := &Histogram{desc: desc{name, help, "histogram", labels}, buckets: buckets, series: make(map[string]*histogramSeries)}
+	r.register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram of the label values
+func (h *Histogram) Observe(value float64, values ...string) {
+	key := h.key(values)
+	h.Lock()
+	defer h.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	s.counts[sort.SearchFloat64s(h.buckets, value)]++
+	s.sum += value
+	s.count++
+}
+
+// Count returns the number of observations of the label values
+func (h *Histogram) Count(values ...string) uint64 {
+	key := h.key(values)
+	h.Lock()
+	defer h.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+// write writes the cumulative buckets, sum and count of every series sorted by label values
+func (h *Histogram) write(w *bufio.Writer) {
+	h.Lock()
+	defer h.Unlock()
+	h.writeHeader(w)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			bound := math.Inf(1)
+			if i < len(h.buckets) {
+				bound = h.buckets[i]
+			}
+			h.writeSample(w, "_bucket", s.values, fmt.Sprintf("le=\"%s\"", formatValue(bound)), float64(cumulative))
+		}
+		h.writeSample(w, "_sum", s.values, "", s.sum)
+		h.writeSample(w, "_count", s.values, "", float64(s.count))
+	}
+}
+
+// sortedKeys returns the keys of series sorted
+func sortedKeys(m map[string]*series) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatValue formats a sample value, integers (e.g. byte counts) without exponent and infinities as +Inf and -Inf
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	case value == math.Trunc(value) && math.Abs(value) < 1e18:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// helpEscaper escapes the backslashes and line feeds of help texts
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// labelEscaper escapes the backslashes, double quotes and line feeds of label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// escapeHelp escapes a help text
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+// escapeLabel escapes a label value
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteText(t *testing.T) {
+
+	registry := NewRegistry()
+	decisions := registry.NewCounter("test_decisions_total", "Decisions by action and result.", "action", "result")
+	reconnects := registry.NewCounter("test_reconnects_total", "Reconnections.")
+	drift := registry.NewGauge("test_drift_bytes", "Drift\\in bytes.")
+	latency := registry.NewHistogram("test_latency_seconds", "Latency by action.", []float64{0.1, 1}, "action")
+	registry.NewGaugeFunc("test_tenant_bytes", "Memory by tenant.", func(emit func(float64, ...string)) {
+		emit(2048, "team-b")
+		emit(1024, `team "a"`)
+	}, "tenant")
+
+	decisions.Inc("container_create", "allow")
+	decisions.Inc("container_create", "allow")
+	decisions.Add(3, "container_create", "deny")
+	drift.Set(-512)
+	latency.Observe(0.05, "container_create")
+	latency.Observe(0.1, "container_create")
+	latency.Observe(2, "container_create")
+
+	expected := `# HELP test_decisions_total Decisions by action and result.
+# TYPE test_decisions_total counter
+test_decisions_total{action="container_create",result="allow"} 2
+test_decisions_total{action="container_create",result="deny"} 3
+# HELP test_drift_bytes Drift\\in bytes.
+# TYPE test_drift_bytes gauge
+test_drift_bytes -512
+# HELP test_latency_seconds Latency by action.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{action="container_create",le="0.1"} 2
+test_latency_seconds_bucket{action="container_create",le="1"} 2
+test_latency_seconds_bucket{action="container_create",le="+Inf"} 3
+test_latency_seconds_sum{action="container_create"} 2.15
+test_latency_seconds_count{action="container_create"} 3
+# HELP test_reconnects_total Reconnections.
+# TYPE test_reconnects_total counter
+test_reconnects_total 0
+# HELP test_tenant_bytes Memory by tenant.
+# TYPE test_tenant_bytes gauge
+test_tenant_bytes{tenant="team \"a\""} 1024
+test_tenant_bytes{tenant="team-b"} 2048
+`
+	var buf bytes.Buffer
+	assert.NoError(t, registry.WriteText(&buf))
+	assert.Equal(t, expected, buf.String())
+
+	assert.Equal(t, float64(2), decisions.Value("container_create", "allow"))
+	assert.Equal(t, float64(0), reconnects.Value())
+	assert.Panics(t, func() { decisions.Inc("container_create") })
+	assert.Panics(t, func() { registry.NewGauge("test_drift_bytes", "Duplicate.") })
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, contentType, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, expected, recorder.Body.String())
+}